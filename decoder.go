@@ -0,0 +1,524 @@
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// bom is the UTF-8 byte order mark that some editors write at the start of
+// a file. It is removed from the start of the input.
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Decoder reads entries from an input stream one at a time.
+type Decoder struct {
+	opts     ReadOptions
+	prefixes []byte
+	sep      byte
+	reserved []byte
+	srcs     []*source
+	err      error
+	resume   bool
+	ctx      context.Context
+	raw      func(line RawLine) error
+	rawbuf   []byte
+
+	linebuf []byte
+	comment []byte
+	ent     Entry
+	start   int
+	offset  int64
+	seen    map[string]map[string]bool
+}
+
+// source is an input stream being read by a Decoder. Included files are
+// pushed on top of the stream that included them.
+type source struct {
+	lines  lineReader
+	closer io.Closer
+	path   string
+	line   int
+}
+
+// lineReader reads lines with their line endings removed.
+type lineReader interface {
+	Scan() bool
+	Bytes() []byte
+	Err() error
+
+	// Offset returns the byte offset of the start of the current line.
+	Offset() int64
+
+	// Raw returns the current line including its line ending.
+	Raw() []byte
+}
+
+// scanLines is a lineReader that uses a bufio.Scanner to read lines and
+// counts the bytes it consumes.
+type scanLines struct {
+	*bufio.Scanner
+	start int64
+	next  int64
+	raw   []byte
+}
+
+// split is bufio.ScanLines but it keeps track of the offset and the raw
+// bytes of each line.
+func (s *scanLines) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if advance > 0 {
+		s.start, s.next = s.next, s.next+int64(advance)
+		s.raw = data[:advance]
+	}
+	return advance, token, err
+}
+
+func (s *scanLines) Offset() int64 { return s.start }
+
+func (s *scanLines) Raw() []byte { return s.raw }
+
+// byteLines is a lineReader over an in-memory slice that splits on the
+// separator regex '\r?\n' and returns sub-slices of it.
+type byteLines struct {
+	data   []byte
+	line   []byte
+	raw    []byte
+	start  int
+	offset int
+}
+
+func (b *byteLines) Scan() bool {
+	if len(b.data) == 0 {
+		return false
+	}
+	b.start = b.offset
+	b.raw = b.data
+	if idx := bytes.IndexByte(b.data, '\n'); idx >= 0 {
+		b.line, b.data = b.data[:idx], b.data[idx+1:]
+		b.offset += idx + 1
+	} else {
+		b.line, b.data = b.data, nil
+		b.offset += len(b.line)
+	}
+	b.raw = b.raw[:b.offset-b.start]
+	if n := len(b.line); n > 0 && b.line[n-1] == '\r' {
+		b.line = b.line[:n-1]
+	}
+	return true
+}
+
+func (b *byteLines) Bytes() []byte { return b.line }
+
+func (b *byteLines) Err() error { return nil }
+
+func (b *byteLines) Offset() int64 { return int64(b.start) }
+
+func (b *byteLines) Raw() []byte { return b.raw }
+
+// NewDecoder returns a Decoder that reads entries from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return newDecoder(r, ReadOptions{})
+}
+
+// newDecoder returns a Decoder that reads entries from r according to opts.
+func newDecoder(r io.Reader, opts ReadOptions) *Decoder {
+	d := newLinesDecoder(newScanner(r, opts), opts)
+
+	// includes are relative to the directory of a named input, like a file.
+	if named, ok := r.(interface{ Name() string }); ok && opts.AllowIncludes {
+		if path, err := filepath.Abs(named.Name()); err == nil {
+			d.srcs[0].path = path
+		}
+	}
+
+	return d
+}
+
+// newLinesDecoder returns a Decoder that reads entries from lines according
+// to opts.
+func newLinesDecoder(lines lineReader, opts ReadOptions) *Decoder {
+	d := &Decoder{
+		opts:     opts,
+		prefixes: opts.commentPrefixes(),
+		sep:      opts.separator(),
+		linebuf:  make([]byte, 0, 64),
+	}
+	d.ent.Section = opts.DefaultSection
+	d.reserved = append([]byte{'[', ']', '\\', d.sep}, d.prefixes...)
+	d.push(lines, nil, "")
+	return d
+}
+
+// newScanner returns a scanner over the lines of r according to opts.
+func newScanner(r io.Reader, opts ReadOptions) *scanLines {
+	s := &scanLines{Scanner: bufio.NewScanner(r)}
+	s.Buffer(nil, opts.maxLineSize())
+	s.Split(s.split)
+	return s
+}
+
+// push starts reading from lines until they are exhausted.
+func (d *Decoder) push(lines lineReader, closer io.Closer, path string) {
+	d.srcs = append(d.srcs, &source{
+		lines:  lines,
+		closer: closer,
+		path:   path,
+	})
+}
+
+// pop stops reading from the most recently pushed source.
+func (d *Decoder) pop() {
+	src := d.srcs[len(d.srcs)-1]
+	if src.closer != nil {
+		_ = src.closer.Close()
+	}
+	d.srcs = d.srcs[:len(d.srcs)-1]
+}
+
+// close stops reading from every source, closing any included files.
+func (d *Decoder) close() {
+	for len(d.srcs) > 0 {
+		d.pop()
+	}
+}
+
+// include pushes the file at path, relative to the directory of the current
+// source, returning an error if it is already being read. If the options
+// have an Include function, it is used to open the path as written instead.
+func (d *Decoder) include(path string) error {
+	if d.opts.Include != nil {
+		if err := d.checkCycle(path); err != nil {
+			return err
+		}
+		r, err := d.opts.Include(path)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		closer, _ := r.(io.Closer)
+		d.push(newScanner(r, d.opts), closer, path)
+		return nil
+	}
+
+	if !filepath.IsAbs(path) {
+		if cur := d.srcs[len(d.srcs)-1].path; cur != "" {
+			path = filepath.Join(filepath.Dir(cur), path)
+		}
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	if err := d.checkCycle(path); err != nil {
+		return err
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	d.push(newScanner(fh, d.opts), fh, path)
+	return nil
+}
+
+// checkCycle returns an error if path is already being read.
+func (d *Decoder) checkCycle(path string) error {
+	for _, src := range d.srcs {
+		if src.path == path {
+			return errs.Tag("include cycle").Errorf("%q", path)
+		}
+	}
+	return nil
+}
+
+// Next returns the next entry. It returns io.EOF when there are no more
+// entries. Once an error is returned, every later call returns it as well.
+func (d *Decoder) Next() (Entry, error) {
+	if d.err != nil {
+		return Entry{}, d.err
+	}
+	ent, err := d.next()
+	if err != nil {
+		if len(d.srcs) > 1 && err != io.EOF {
+			err = errs.Errorf("%s: %w", d.srcs[len(d.srcs)-1].path, err)
+		}
+		// when resuming, an invalid line is skipped so that reading can
+		// continue with the line after it.
+		if d.resume && errors.As(err, new(*ParseError)) {
+			d.comment = d.comment[:0]
+			d.linebuf = d.linebuf[:0]
+			return Entry{}, err
+		}
+		d.close()
+		d.err = err
+		return Entry{}, err
+	}
+	return ent, nil
+}
+
+// next scans lines until an entry is emitted.
+func (d *Decoder) next() (Entry, error) {
+	for {
+		if d.ctx != nil {
+			if err := d.ctx.Err(); err != nil {
+				return Entry{}, err
+			}
+		}
+
+		src := d.srcs[len(d.srcs)-1]
+		if !src.lines.Scan() {
+			if err := src.lines.Err(); errors.Is(err, bufio.ErrTooLong) {
+				return Entry{}, errs.Tag("line too long").Errorf(
+					"line %d is longer than %d bytes; raise ReadOptions.MaxLineSize to read it: %w",
+					src.line+1, d.opts.maxLineSize(), err)
+			} else if err != nil {
+				return Entry{}, errs.Tag("read").Wrap(err)
+			}
+			if d.opts.Strict && len(d.linebuf) > 0 {
+				return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+					Line:    d.start,
+					Content: string(d.linebuf),
+					Reason:  "continued line at end of input",
+				})
+			}
+			if len(d.linebuf) > 0 {
+				d.linebuf = d.linebuf[:0]
+				if err := d.rawLine(RawLine{Kind: DroppedLine}); err != nil {
+					return Entry{}, err
+				}
+			}
+			if len(d.srcs) == 1 {
+				return Entry{}, io.EOF
+			}
+			d.pop()
+			continue
+		}
+
+		src.line++
+		if len(d.linebuf) == 0 {
+			d.start = src.line
+			d.offset = src.lines.Offset()
+			d.rawbuf = d.rawbuf[:0]
+		}
+		if d.raw != nil {
+			d.rawbuf = append(d.rawbuf, src.lines.Raw()...)
+		}
+		buf := src.lines.Bytes()
+		if src.line == 1 && bytes.HasPrefix(buf, bom) {
+			buf = buf[len(bom):]
+			d.offset += int64(len(bom))
+		}
+		d.linebuf = append(d.linebuf, buf...)
+		linebuf := d.linebuf
+
+		if len(linebuf) == 0 || len(bytes.TrimSpace(linebuf)) == 0 {
+			if d.opts.Strict && d.start != src.line {
+				return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+					Line:    d.start,
+					Content: string(linebuf),
+					Reason:  "continued blank line",
+				})
+			}
+			d.linebuf = d.linebuf[:0]
+			if err := d.rawLine(RawLine{Kind: BlankLine}); err != nil {
+				return Entry{}, err
+			}
+			continue
+		}
+
+		if linebuf[len(linebuf)-1] == '\\' {
+			linebuf[len(linebuf)-1] = '\n'
+			continue
+		}
+
+		if d.opts.AllowIncludes || d.opts.Include != nil {
+			trimmed := bytes.TrimSpace(linebuf)
+			if rest := bytes.TrimPrefix(trimmed, d.opts.includeDirective()); len(rest) < len(trimmed) &&
+				len(rest) > 0 && unicode.IsSpace(rune(rest[0])) {
+				d.linebuf = d.linebuf[:0]
+				if err := d.include(string(bytes.TrimSpace(rest))); err != nil {
+					return Entry{}, err
+				}
+				continue
+			}
+		}
+
+		if trimmed := bytes.TrimLeftFunc(linebuf, unicode.IsSpace); bytes.IndexByte(d.prefixes, trimmed[0]) >= 0 {
+			if d.opts.Strict && d.start != src.line {
+				return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+					Line:    d.start,
+					Content: string(linebuf),
+					Reason:  "continued comment",
+				})
+			}
+			line := trimmed[1:]
+			if len(line) > 0 && line[0] == ' ' {
+				line = line[1:]
+			}
+			d.comment = append(d.comment, line...)
+			d.comment = append(d.comment, '\n')
+			d.linebuf = d.linebuf[:0]
+			if err := d.rawLine(RawLine{Kind: CommentLine, Comment: string(line)}); err != nil {
+				return Entry{}, err
+			}
+			continue
+		}
+
+		if linebuf[0] == '[' && linebuf[len(linebuf)-1] == ']' {
+			section := linebuf[1 : len(linebuf)-1]
+			if idx := indexReserved(section, d.reserved); idx >= 0 {
+				return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+					Line:    d.start,
+					Content: string(linebuf),
+					Reason:  fmt.Sprintf("section name contains %q", section[idx]),
+				})
+			}
+			d.ent.Section = string(unescapeReserved(section, d.reserved))
+			if d.ent.Section == "" {
+				d.ent.Section = d.opts.DefaultSection
+			}
+			d.comment = d.comment[:0]
+			d.linebuf = d.linebuf[:0]
+			if err := d.rawLine(RawLine{Kind: SectionLine}); err != nil {
+				return Entry{}, err
+			}
+			continue
+		}
+
+		if idx := indexUnescaped(linebuf, d.sep); idx >= 0 {
+			if d.opts.RequireSpacedSeparator && !spacedAt(linebuf, idx) {
+				return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+					Line:    d.start,
+					Content: string(linebuf),
+					Reason:  "separator not surrounded by spaces",
+				})
+			}
+			value := linebuf[idx+1:]
+			if d.opts.InlineComments {
+				var comment []byte
+				value, comment = stripInlineComment(value, d.prefixes)
+				if comment != nil {
+					d.comment = append(d.comment, comment...)
+					d.comment = append(d.comment, '\n')
+				}
+			}
+			ent := Entry{Section: d.ent.Section}
+			if d.opts.PreserveKeySpace {
+				ent.Key = string(unescapeReserved(linebuf[:idx], d.reserved))
+			} else {
+				ent.Key = string(unquote(unescapeReserved(bytes.TrimSpace(linebuf[:idx]), d.reserved)))
+			}
+			if ent.Key == "" && d.opts.RejectEmptyKey {
+				return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+					Line:    d.start,
+					Content: string(linebuf),
+					Reason:  "empty key",
+				})
+			}
+			if d.opts.SectionFromKeyDot && ent.Section == d.opts.DefaultSection {
+				if dot := strings.IndexByte(ent.Key, '.'); dot >= 0 {
+					ent.Section, ent.Key = ent.Key[:dot], ent.Key[dot+1:]
+				}
+			}
+			if d.opts.PreserveValueSpace {
+				ent.Value = string(value)
+			} else {
+				ent.Value = string(unquote(bytes.TrimSpace(value)))
+			}
+			if d.opts.ExpandEnv {
+				ent.Value = expandEnv(ent.Value)
+			}
+			ent.Comment = string(bytes.TrimSuffix(d.comment, []byte{'\n'}))
+			skip, err := d.checkDuplicate(ent)
+			if err != nil {
+				return Entry{}, err
+			}
+			d.comment = d.comment[:0]
+			d.linebuf = d.linebuf[:0]
+			if err := d.rawLine(RawLine{Kind: EntryLine, Key: ent.Key, Value: ent.Value}); err != nil {
+				return Entry{}, err
+			}
+			if skip {
+				continue
+			}
+			return ent, nil
+		}
+
+		return Entry{}, errs.Tag("invalid line").Wrap(&ParseError{
+			Line:    d.start,
+			Content: string(linebuf),
+		})
+	}
+}
+
+// spacedAt returns true if the byte at idx is preceded and followed by a
+// space, or by the start or end of x.
+func spacedAt(x []byte, idx int) bool {
+	if idx > 0 && !unicode.IsSpace(rune(x[idx-1])) {
+		return false
+	}
+	if idx+1 < len(x) && !unicode.IsSpace(rune(x[idx+1])) {
+		return false
+	}
+	return true
+}
+
+// rawLine calls the raw callback, if any, with the line after filling in its
+// section and raw contents.
+func (d *Decoder) rawLine(line RawLine) error {
+	if d.raw == nil {
+		return nil
+	}
+	line.Section = d.ent.Section
+	line.Raw = string(d.rawbuf)
+	return d.raw(line)
+}
+
+// Pos returns the position of the entry most recently returned by Next. For
+// entries from an included file, it is the position within that file.
+func (d *Decoder) Pos() Pos {
+	return Pos{Line: d.start, Offset: d.offset}
+}
+
+// checkDuplicate applies the duplicate key policy to ent, returning true if
+// it should be skipped or an error if duplicates are rejected and the key of
+// ent has already been seen in its section.
+func (d *Decoder) checkDuplicate(ent Entry) (bool, error) {
+	if d.opts.DuplicateKeys == DuplicateAllow {
+		return false, nil
+	}
+	if d.seen == nil {
+		d.seen = make(map[string]map[string]bool)
+	}
+	if d.seen[ent.Section] == nil {
+		d.seen[ent.Section] = make(map[string]bool)
+	}
+	if d.seen[ent.Section][ent.Key] {
+		if d.opts.DuplicateKeys == DuplicateFirstWins {
+			return true, nil
+		}
+		return false, errs.Tag("duplicate key").Errorf("line %d: section %q key %q",
+			d.start, ent.Section, ent.Key)
+	}
+	d.seen[ent.Section][ent.Key] = true
+	return false, nil
+}
+
+// expandEnv replaces ${VAR} and $VAR with the value of the environment
+// variable, or the empty string if it is unset, and $$ with $.
+func expandEnv(value string) string {
+	return os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
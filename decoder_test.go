@@ -0,0 +1,256 @@
+package ini
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/errs/v2"
+)
+
+func TestDecoder(t *testing.T) {
+	for _, test := range tests {
+		var got []Entry
+		dec := NewDecoder(test.Reader())
+		for {
+			ent, err := dec.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			got = append(got, ent)
+		}
+		assert.DeepEqual(t, got, test.Entries)
+	}
+}
+
+func TestDecoder_Sections(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(strings.Join([]string{
+		"top = level",
+		"[a]",
+		"# comment",
+		"foo = 1",
+		"[b]",
+		"bar = 2",
+		"invalid",
+	}, "\n")))
+
+	for _, exp := range []Entry{
+		{Key: "top", Value: "level"},
+		{Section: "a", Key: "foo", Value: "1", Comment: "comment"},
+		{Section: "b", Key: "bar", Value: "2"},
+	} {
+		ent, err := dec.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, ent, exp)
+	}
+
+	_, err := dec.Next()
+	assert.Error(t, err)
+	_, again := dec.Next()
+	assert.Equal(t, again, err)
+}
+
+// setenv sets the environment variable until the test finishes.
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	assert.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func TestReadWith_ExpandEnv(t *testing.T) {
+	setenv(t, "INI_TEST_HOST", "example.com")
+	setenv(t, "INI_TEST_PORT", "443")
+
+	data := strings.Join([]string{
+		"url = https://${INI_TEST_HOST}:$INI_TEST_PORT/",
+		"missing = [${INI_TEST_MISSING}]",
+		"price = $$5",
+		`quoted = " $INI_TEST_HOST "`,
+	}, "\n")
+
+	var got []Entry
+	assert.NoError(t, ReadWith(strings.NewReader(data), ReadOptions{ExpandEnv: true}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "url", Value: "https://example.com:443/"},
+		{Key: "missing", Value: "[]"},
+		{Key: "price", Value: "$5"},
+		{Key: "quoted", Value: " example.com "},
+	})
+
+	raw, err := ReadAll(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, raw[0].Value, "https://${INI_TEST_HOST}:$INI_TEST_PORT/")
+}
+
+func TestReadWith_AllowIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		return path
+	}
+
+	root := write("root.ini", "a = 1\n[s]\n@include sub/child.ini\nb = 2\n")
+	write("sub/child.ini", "c = 3\n@include grandchild.ini\n")
+	write("sub/grandchild.ini", "[t]\nd = 4\n")
+
+	fh, err := os.Open(root)
+	assert.NoError(t, err)
+	defer func() { _ = fh.Close() }()
+
+	var got []Entry
+	assert.NoError(t, ReadWith(fh, ReadOptions{AllowIncludes: true}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "a", Value: "1"},
+		{Section: "s", Key: "c", Value: "3"},
+		{Section: "t", Key: "d", Value: "4"},
+		{Section: "t", Key: "b", Value: "2"},
+	})
+
+	got, err = ReadAll(strings.NewReader("@include x = y"))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{{Key: "@include x", Value: "y"}})
+}
+
+func TestReadWith_IncludeStop(t *testing.T) {
+	child := filepath.Join(t.TempDir(), "child.ini")
+	assert.NoError(t, os.WriteFile(child, []byte("c = 3\nd = 4\n"), 0644))
+
+	for _, stop := range []error{ErrStop, errors.New("stop")} {
+		dec := newDecoder(strings.NewReader("@include "+child+"\n"), ReadOptions{AllowIncludes: true})
+
+		var fh *os.File
+		err := readDecoder(dec, func(ent Entry) error {
+			fh = dec.srcs[len(dec.srcs)-1].closer.(*os.File)
+			return stop
+		})
+		if stop != ErrStop {
+			assert.Equal(t, err, stop)
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, len(dec.srcs), 0)
+		assert.That(t, errors.Is(fh.Close(), os.ErrClosed))
+	}
+}
+
+func TestReadWith_IncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.ini")
+	assert.NoError(t, os.WriteFile(a, []byte("@include b.ini\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.ini"), []byte("x = 1\n@include a.ini\n"), 0644))
+
+	fh, err := os.Open(a)
+	assert.NoError(t, err)
+	defer func() { _ = fh.Close() }()
+
+	err = ReadWith(fh, ReadOptions{AllowIncludes: true}, func(ent Entry) error { return nil })
+	assert.Error(t, err)
+	assert.That(t, errors.Is(err, errs.Tag("include cycle")))
+}
+
+func TestReadWith_Include(t *testing.T) {
+	files := map[string]string{
+		"a.ini": "a = 1\n#include b.ini\nc = 3\n",
+		"b.ini": "b = 2\n",
+	}
+	opts := ReadOptions{
+		IncludeDirective: "#include",
+		Include: func(path string) (io.Reader, error) {
+			data, ok := files[path]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return strings.NewReader(data), nil
+		},
+	}
+
+	var got []Entry
+	err := ReadWith(strings.NewReader("[s]\n#include a.ini\nd = 4\n"), opts, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "s", Key: "a", Value: "1"},
+		{Section: "s", Key: "b", Value: "2"},
+		{Section: "s", Key: "c", Value: "3"},
+		{Section: "s", Key: "d", Value: "4"},
+	})
+
+	files["b.ini"] = "#include a.ini\n"
+	err = ReadWith(strings.NewReader("#include a.ini\n"), opts, func(ent Entry) error { return nil })
+	assert.Error(t, err)
+	assert.That(t, errors.Is(err, errs.Tag("include cycle")))
+
+	err = ReadWith(strings.NewReader("#include missing.ini\n"), opts, func(ent Entry) error { return nil })
+	assert.That(t, errors.Is(err, os.ErrNotExist))
+}
+
+// closeReader records whether it was closed.
+type closeReader struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReadWith_IncludeClose(t *testing.T) {
+	var readers []*closeReader
+	opts := ReadOptions{
+		Include: func(path string) (io.Reader, error) {
+			cr := &closeReader{Reader: strings.NewReader("a = 1\nb = 2\n")}
+			readers = append(readers, cr)
+			return cr, nil
+		},
+	}
+
+	err := ReadWith(strings.NewReader("@include x\n"), opts, func(ent Entry) error { return nil })
+	assert.NoError(t, err)
+
+	err = ReadWith(strings.NewReader("@include x\n"), opts, func(ent Entry) error { return ErrStop })
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(readers), 2)
+	for _, cr := range readers {
+		assert.That(t, cr.closed)
+	}
+}
+
+func TestReadWith_IncludeError(t *testing.T) {
+	dir := t.TempDir()
+	child := filepath.Join(dir, "child.ini")
+	assert.NoError(t, os.WriteFile(child, []byte("ok = 1\n\ninvalid\n"), 0644))
+
+	err := ReadWith(strings.NewReader("@include "+child), ReadOptions{AllowIncludes: true}, func(ent Entry) error { return nil })
+	assert.Error(t, err)
+	assert.That(t, strings.Contains(err.Error(), child))
+
+	var perr *ParseError
+	assert.That(t, errors.As(err, &perr))
+	assert.Equal(t, perr.Line, 3)
+
+	err = ReadWith(strings.NewReader("@include "+filepath.Join(dir, "missing.ini")), ReadOptions{AllowIncludes: true}, func(ent Entry) error { return nil })
+	assert.Error(t, err)
+}
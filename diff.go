@@ -0,0 +1,137 @@
+package ini
+
+// ChangeKind is the kind of difference between two documents.
+type ChangeKind int
+
+const (
+	// Added means the key exists only in the second document.
+	Added ChangeKind = iota + 1
+
+	// Removed means the key exists only in the first document.
+	Removed
+
+	// Modified means the key exists in both documents with different values,
+	// or different comments when comparing them.
+	Modified
+)
+
+// String returns the name of the kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a difference in the value of a key between two documents. Old is
+// empty for added keys and New is empty for removed keys. The comments are
+// only filled in when comparing them with DiffOptions.Comments.
+type Change struct {
+	Kind       ChangeKind
+	Section    string
+	Key        string
+	Old        string
+	New        string
+	OldComment string
+	NewComment string
+}
+
+// DiffOptions controls how DiffWith compares documents.
+type DiffOptions struct {
+	// Comments causes keys whose comment differs to be reported as modified
+	// even if their value is the same.
+	Comments bool
+}
+
+// Diff returns the changes needed to turn document a into document b, sorted
+// by section and then by key. Keys are compared by their last value, as
+// returned by Get, so repeated keys are not reported unless their last value
+// differs. Changes to comments are ignored. A nil document is treated as
+// empty.
+//
+// If either document has FoldCase set, sections and keys that differ only in
+// case are compared as the same and reported once, under their name in a if
+// it has them.
+func Diff(a, b *Document) []Change {
+	return DiffWith(a, b, DiffOptions{})
+}
+
+// diffName is how a section and key compared by DiffWith are named in each
+// of the two documents, if they are in it.
+type diffName struct {
+	section [2]string
+	key     [2]string
+	in      [2]bool
+}
+
+// DiffWith is like Diff but compares the documents according to opts.
+func DiffWith(a, b *Document, opts DiffOptions) (changes []Change) {
+	docs := [2]*Document{a, b}
+	for i, doc := range docs {
+		if doc == nil {
+			docs[i] = new(Document)
+		}
+	}
+	cmp := &Document{FoldCase: docs[0].FoldCase || docs[1].FoldCase}
+
+	names := make(map[string]map[string]*diffName)
+	for i, doc := range docs {
+		for _, sec := range doc.sections {
+			keys := names[cmp.indexKey(sec.name)]
+			if keys == nil {
+				keys = make(map[string]*diffName)
+				names[cmp.indexKey(sec.name)] = keys
+			}
+			for _, ent := range sec.entries {
+				name := keys[cmp.indexKey(ent.Key)]
+				if name == nil {
+					name = new(diffName)
+					keys[cmp.indexKey(ent.Key)] = name
+				}
+				if !name.in[i] {
+					name.section[i], name.key[i], name.in[i] = sec.name, ent.Key, true
+				}
+			}
+		}
+	}
+
+	for _, section := range sortedKeys(names) {
+		for _, key := range sortedKeys(names[section]) {
+			name := names[section][key]
+
+			var ents [2]Entry
+			for i, doc := range docs {
+				if name.in[i] {
+					ents[i], _ = doc.entry(name.section[i], name.key[i])
+				}
+			}
+			before, after := ents[0], ents[1]
+
+			ch := Change{Section: name.section[0], Key: name.key[0], Old: before.Value, New: after.Value}
+			if !name.in[0] {
+				ch.Section, ch.Key = name.section[1], name.key[1]
+			}
+			if opts.Comments {
+				ch.OldComment, ch.NewComment = before.Comment, after.Comment
+			}
+			switch {
+			case name.in[0] && !name.in[1]:
+				ch.Kind = Removed
+			case !name.in[0] && name.in[1]:
+				ch.Kind = Added
+			case ch.Old != ch.New || ch.OldComment != ch.NewComment:
+				ch.Kind = Modified
+			default:
+				continue
+			}
+			changes = append(changes, ch)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,90 @@
+package ini
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := Parse(strings.NewReader(strings.Join([]string{
+		"top = 1",
+		"[b]",
+		"same = x",
+		"changed = old",
+		"removed = gone",
+		"[a]",
+		"repeated = 1",
+		"repeated = 2",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	b, err := Parse(strings.NewReader(strings.Join([]string{
+		"[a]",
+		"repeated = 2",
+		"[b]",
+		"added = new",
+		"changed = new",
+		"same = x",
+		"[c]",
+		"key = value",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.DeepEqual(t, Diff(a, b), []Change{
+		{Kind: Removed, Section: "", Key: "top", Old: "1"},
+		{Kind: Added, Section: "b", Key: "added", New: "new"},
+		{Kind: Modified, Section: "b", Key: "changed", Old: "old", New: "new"},
+		{Kind: Removed, Section: "b", Key: "removed", Old: "gone"},
+		{Kind: Added, Section: "c", Key: "key", New: "value"},
+	})
+
+	assert.Equal(t, len(Diff(a, a)), 0)
+	assert.Equal(t, Modified.String(), "modified")
+}
+
+func TestDiffWith_Comments(t *testing.T) {
+	a, err := Parse(strings.NewReader("# old\nkey = value\nother = 1\n"))
+	assert.NoError(t, err)
+	b, err := Parse(strings.NewReader("# new\nkey = value\nother = 2\n"))
+	assert.NoError(t, err)
+
+	assert.DeepEqual(t, Diff(a, b), []Change{
+		{Kind: Modified, Key: "other", Old: "1", New: "2"},
+	})
+	assert.DeepEqual(t, DiffWith(a, b, DiffOptions{Comments: true}), []Change{
+		{Kind: Modified, Key: "key", Old: "value", New: "value", OldComment: "old", NewComment: "new"},
+		{Kind: Modified, Key: "other", Old: "1", New: "2"},
+	})
+}
+
+func TestDiff_FoldCase(t *testing.T) {
+	a, err := Parse(strings.NewReader("[Server]\nHost = a\nPort = 80\n"))
+	assert.NoError(t, err)
+	b, err := Parse(strings.NewReader("[server]\nhost = b\nport = 80\n"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(Diff(a, b)), 4)
+
+	a.FoldCase = true
+	assert.DeepEqual(t, Diff(a, b), []Change{
+		{Kind: Modified, Section: "Server", Key: "Host", Old: "a", New: "b"},
+	})
+	assert.DeepEqual(t, Diff(b, a), []Change{
+		{Kind: Modified, Section: "server", Key: "host", Old: "b", New: "a"},
+	})
+}
+
+func TestDiff_Nil(t *testing.T) {
+	a, err := Parse(strings.NewReader("key = value\n"))
+	assert.NoError(t, err)
+
+	assert.DeepEqual(t, Diff(nil, a), []Change{
+		{Kind: Added, Key: "key", New: "value"},
+	})
+	assert.DeepEqual(t, Diff(a, nil), []Change{
+		{Kind: Removed, Key: "key", Old: "value"},
+	})
+	assert.Equal(t, len(Diff(nil, nil)), 0)
+}
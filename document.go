@@ -0,0 +1,512 @@
+package ini
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// Document is an ordered collection of entries grouped by section. Sections
+// and the entries within them keep the order they were first added in, and
+// entries keep their comments.
+//
+// Writing a parsed document that has not been modified reproduces its input
+// except for the normalization that Write performs:
+//
+//   - entries are written as "key = value" with values quoted as needed
+//   - comments are written one line at a time as "# comment"
+//   - comments before a section declaration are dropped
+//   - empty lines are removed except for a single one before each section
+//     and those between the entries of a section
+//   - repeated declarations of a section are merged into the first
+type Document struct {
+	// FoldCase causes sections and keys to be matched the same way as
+	// strings.EqualFold, which compares them under simple Unicode case
+	// folding. Only lookups are affected: the stored sections and keys keep
+	// the case they were added with and are written that way.
+	FoldCase bool
+
+	// CollapseBlankLines causes runs of empty lines between the entries of a
+	// section to be written as a single empty line.
+	CollapseBlankLines bool
+
+	sections []*docSection
+	index    map[string]*docSection // sections by their index key
+	folded   bool                   // FoldCase when index was built
+}
+
+// docSection is a section and its entries in order.
+type docSection struct {
+	name    string
+	entries []docEntry
+	keys    map[string]int // index key to position of the key's last entry
+}
+
+// docEntry is an entry along with the number of empty lines before it.
+type docEntry struct {
+	Entry
+	blanks int
+}
+
+// Parse reads every entry from r into a Document. Entries for a section that
+// is declared more than once are grouped with the first declaration.
+func Parse(r io.Reader) (*Document, error) {
+	d := new(Document)
+	blanks := 0
+
+	dec := newDecoder(r, ReadOptions{})
+	dec.raw = func(line RawLine) error {
+		switch line.Kind {
+		case BlankLine:
+			blanks++
+		case SectionLine:
+			blanks = 0
+		}
+		return nil
+	}
+	err := readDecoder(dec, func(ent Entry) error {
+		d.appendEntry(d.section(ent.Section, true), docEntry{Entry: ent, blanks: blanks})
+		blanks = 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// section returns the section with the given name, creating it at the end of
+// the document if it does not exist and create is true.
+func (d *Document) section(name string, create bool) *docSection {
+	d.reindex()
+	if sec, ok := d.index[d.indexKey(name)]; ok {
+		return sec
+	}
+	if !create {
+		return nil
+	}
+	sec := &docSection{name: name, keys: make(map[string]int)}
+	d.sections = append(d.sections, sec)
+	d.index[d.indexKey(name)] = sec
+	return sec
+}
+
+// appendEntry adds the entry to the end of the section.
+func (d *Document) appendEntry(sec *docSection, ent docEntry) {
+	sec.entries = append(sec.entries, ent)
+	sec.keys[d.indexKey(ent.Key)] = len(sec.entries) - 1
+}
+
+// reindex builds the index of sections and keys if it has not been built or
+// if FoldCase has changed since it was.
+func (d *Document) reindex() {
+	if d.index != nil && d.folded == d.FoldCase {
+		return
+	}
+	d.index, d.folded = make(map[string]*docSection, len(d.sections)), d.FoldCase
+	for _, sec := range d.sections {
+		if _, ok := d.index[d.indexKey(sec.name)]; !ok {
+			d.index[d.indexKey(sec.name)] = sec
+		}
+		d.reindexKeys(sec)
+	}
+}
+
+// reindexKeys rebuilds the index of the keys in the section.
+func (d *Document) reindexKeys(sec *docSection) {
+	sec.keys = make(map[string]int, len(sec.entries))
+	for i, ent := range sec.entries {
+		sec.keys[d.indexKey(ent.Key)] = i
+	}
+}
+
+// indexKey returns the key that a section or key name is indexed by, which
+// is the name itself unless FoldCase is set.
+func (d *Document) indexKey(name string) string {
+	if d.FoldCase {
+		return foldCase(name)
+	}
+	return name
+}
+
+// foldCase replaces every rune in s with the smallest rune it is equal to
+// under simple Unicode case folding, so that two strings are equal under
+// strings.EqualFold exactly when their folded forms are equal.
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		least := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < least {
+				least = f
+			}
+		}
+		return least
+	}, s)
+}
+
+// match returns true if the section or key names a and b are the same.
+func (d *Document) match(a, b string) bool {
+	if d.FoldCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// lookup returns the index of the last entry in the section with the given
+// key, or -1.
+func (d *Document) lookup(sec *docSection, key string) int {
+	d.reindex()
+	if idx, ok := sec.keys[d.indexKey(key)]; ok {
+		return idx
+	}
+	return -1
+}
+
+// Sections returns the names of the sections that have entries in the order
+// they were first added, including the empty section for top-level entries.
+func (d *Document) Sections() (names []string) {
+	for _, sec := range d.sections {
+		if len(sec.entries) > 0 {
+			names = append(names, sec.name)
+		}
+	}
+	return names
+}
+
+// Keys returns the keys in the section in the order they were first added.
+// Repeated keys are only returned once.
+func (d *Document) Keys(section string) (keys []string) {
+	sec := d.section(section, false)
+	if sec == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(sec.keys))
+	for _, ent := range sec.entries {
+		if key := d.indexKey(ent.Key); !seen[key] {
+			seen[key] = true
+			keys = append(keys, ent.Key)
+		}
+	}
+	return keys
+}
+
+// Get returns the value of the key in the section. If the key is repeated,
+// the last value is returned.
+func (d *Document) Get(section, key string) (string, bool) {
+	ent, ok := d.entry(section, key)
+	return ent.Value, ok
+}
+
+// entry returns the last entry for the key in the section.
+func (d *Document) entry(section, key string) (Entry, bool) {
+	sec := d.section(section, false)
+	if sec == nil {
+		return Entry{}, false
+	}
+	idx := d.lookup(sec, key)
+	if idx < 0 {
+		return Entry{}, false
+	}
+	return sec.entries[idx].Entry, true
+}
+
+// value returns the value of the key in the section or an ErrKeyNotFound
+// error if it does not exist.
+func (d *Document) value(section, key string) (string, error) {
+	value, ok := d.Get(section, key)
+	if !ok {
+		return "", ErrKeyNotFound.Errorf("section %q key %q", section, key)
+	}
+	return value, nil
+}
+
+// GetInt returns the value of the key in the section parsed as a base 10
+// int64.
+func (d *Document) GetInt(section, key string) (int64, error) {
+	value, err := d.value(section, key)
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errs.Errorf("section %q key %q: %w", section, key, err)
+	}
+	return x, nil
+}
+
+// GetBool returns the value of the key in the section parsed as a bool. It
+// accepts true/false, yes/no, on/off, and 1/0 in any case.
+func (d *Document) GetBool(section, key string) (bool, error) {
+	value, err := d.value(section, key)
+	if err != nil {
+		return false, err
+	}
+	x, err := parseBool(value)
+	if err != nil {
+		return false, errs.Errorf("section %q key %q: %w", section, key, err)
+	}
+	return x, nil
+}
+
+// GetFloat64 returns the value of the key in the section parsed as a
+// float64.
+func (d *Document) GetFloat64(section, key string) (float64, error) {
+	value, err := d.value(section, key)
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errs.Errorf("section %q key %q: %w", section, key, err)
+	}
+	return x, nil
+}
+
+// GetDefault returns the value of the key in the section, or def if it does
+// not exist. An existing empty value is returned as is.
+func (d *Document) GetDefault(section, key, def string) string {
+	if value, ok := d.Get(section, key); ok {
+		return value
+	}
+	return def
+}
+
+// GetIntDefault is like GetInt but returns def instead of an error, both
+// when the key does not exist and when its value can not be parsed. Use
+// GetInt to tell those cases apart.
+func (d *Document) GetIntDefault(section, key string, def int64) int64 {
+	if x, err := d.GetInt(section, key); err == nil {
+		return x
+	}
+	return def
+}
+
+// GetBoolDefault is like GetBool but returns def instead of an error, both
+// when the key does not exist and when its value can not be parsed. Use
+// GetBool to tell those cases apart.
+func (d *Document) GetBoolDefault(section, key string, def bool) bool {
+	if x, err := d.GetBool(section, key); err == nil {
+		return x
+	}
+	return def
+}
+
+// GetFloat64Default is like GetFloat64 but returns def instead of an error,
+// both when the key does not exist and when its value can not be parsed. Use
+// GetFloat64 to tell those cases apart.
+func (d *Document) GetFloat64Default(section, key string, def float64) float64 {
+	if x, err := d.GetFloat64(section, key); err == nil {
+		return x
+	}
+	return def
+}
+
+// GetList returns the value of the key in the section split on sep, with
+// every element space trimmed. Elements may be quoted like values to keep
+// surrounding space or to contain sep. It returns nil if the key does not
+// exist or its value is empty.
+func (d *Document) GetList(section, key, sep string) []string {
+	value, ok := d.Get(section, key)
+	if !ok || value == "" {
+		return nil
+	} else if sep == "" {
+		return []string{listElement(value)}
+	}
+
+	var list []string
+	start, quoted := 0, false
+	for i := 0; i < len(value); i++ {
+		switch {
+		case quoted && value[i] == '\\':
+			i++
+		case value[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(value[i:], sep):
+			list = append(list, listElement(value[start:i]))
+			start = i + len(sep)
+			i = start - 1
+		}
+	}
+	return append(list, listElement(value[start:]))
+}
+
+// listElement trims and unquotes an element of a list.
+func listElement(x string) string {
+	return string(unquote([]byte(strings.TrimSpace(x))))
+}
+
+// SetList sets the value of the key in the section to the elements joined
+// with sep, as read by GetList. Elements that contain sep or a quote, or that
+// have surrounding space, are quoted.
+func (d *Document) SetList(section, key, sep string, list []string) {
+	elems := make([]string, len(list))
+	for i, elem := range list {
+		if strings.TrimSpace(elem) != elem || strings.Contains(elem, `"`) ||
+			(sep != "" && strings.Contains(elem, sep)) {
+			elem = `"` + quoteReplacer.Replace(elem) + `"`
+		}
+		elems[i] = elem
+	}
+	d.Set(section, key, strings.Join(elems, sep))
+}
+
+// GetAll returns every value of the key in the section in order.
+func (d *Document) GetAll(section, key string) (values []string) {
+	sec := d.section(section, false)
+	if sec == nil {
+		return nil
+	}
+	for _, ent := range sec.entries {
+		if d.match(ent.Key, key) {
+			values = append(values, ent.Value)
+		}
+	}
+	return values
+}
+
+// Set updates the value of the key in the section. If the key is repeated,
+// the last entry is updated. If it does not exist, it is added to the end of
+// the section, and the section is added to the end of the document if needed.
+func (d *Document) Set(section, key, value string) {
+	sec := d.section(section, true)
+	if idx := d.lookup(sec, key); idx >= 0 {
+		sec.entries[idx].Value = value
+		return
+	}
+	d.appendEntry(sec, docEntry{Entry: Entry{
+		Section: sec.name,
+		Key:     key,
+		Value:   value,
+	}})
+}
+
+// Delete removes every entry for the key in the section and returns true if
+// any existed.
+func (d *Document) Delete(section, key string) bool {
+	sec := d.section(section, false)
+	if sec == nil {
+		return false
+	}
+	entries := sec.entries[:0]
+	for _, ent := range sec.entries {
+		if !d.match(ent.Key, key) {
+			entries = append(entries, ent)
+		}
+	}
+	deleted := len(entries) != len(sec.entries)
+	sec.entries = entries
+	if deleted {
+		d.reindexKeys(sec)
+	}
+	return deleted
+}
+
+// DeleteSection removes the section and every entry in it and returns true
+// if it had any entries. The order of the remaining sections is unchanged.
+func (d *Document) DeleteSection(section string) bool {
+	deleted := false
+	sections := d.sections[:0]
+	for _, sec := range d.sections {
+		if d.match(sec.name, section) {
+			deleted = deleted || len(sec.entries) > 0
+			continue
+		}
+		sections = append(sections, sec)
+	}
+	d.sections = sections
+	delete(d.index, d.indexKey(section))
+	return deleted
+}
+
+// RenameSection moves every entry in the section from to the section to,
+// keeping their order and the position of the section in the document. It
+// returns an error if from does not exist or if to already has entries, so
+// that sections are never merged by accident.
+func (d *Document) RenameSection(from, to string) error {
+	sec := d.section(from, false)
+	if sec == nil {
+		return errs.Tag("section not found").Errorf("%q", from)
+	}
+	if dst := d.section(to, false); dst != nil && dst != sec {
+		if len(dst.entries) > 0 {
+			return errs.Tag("section exists").Errorf("%q", to)
+		}
+		d.DeleteSection(to)
+	}
+
+	delete(d.index, d.indexKey(from))
+	d.index[d.indexKey(to)] = sec
+	sec.name = to
+	for i := range sec.entries {
+		sec.entries[i].Section = to
+	}
+	return nil
+}
+
+// Merge returns a new document containing the entries of every document in
+// docs. Later documents take precedence: when a section and key appear in
+// more than one document, the value of the last one wins, along with its
+// comment if it has one. Sections and keys keep the order they first appeared
+// in, so keys that only appear in earlier documents keep their place. A key
+// repeated within one document is merged the same way, so the result has a
+// single entry for it with its last value and GetAll returns only that. If
+// any of the documents folds case, the result does as well. Nil documents
+// are skipped.
+func Merge(docs ...*Document) *Document {
+	out := new(Document)
+	for _, doc := range docs {
+		if doc != nil && doc.FoldCase {
+			out.FoldCase = true
+		}
+	}
+
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for _, sec := range doc.sections {
+			dst := out.section(sec.name, true)
+			for _, ent := range sec.entries {
+				if idx := out.lookup(dst, ent.Key); idx >= 0 {
+					dst.entries[idx].Value = ent.Value
+					if ent.Comment != "" {
+						dst.entries[idx].Comment = ent.Comment
+					}
+					continue
+				}
+				ent.Section = dst.name
+				out.appendEntry(dst, ent)
+			}
+		}
+	}
+	return out
+}
+
+// Document implements io.WriterTo so that it can be used wherever one is
+// accepted.
+var _ io.WriterTo = (*Document)(nil)
+
+// WriteTo writes the document to w in order. It returns the number of bytes
+// written, even if writing fails partway.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	wr := newWriter(w, WriteOptions{})
+	for _, sec := range d.sections {
+		for i, ent := range sec.entries {
+			blanks := ent.blanks
+			if i == 0 {
+				blanks = 0
+			} else if d.CollapseBlankLines && blanks > 1 {
+				blanks = 1
+			}
+			for ; blanks > 0; blanks-- {
+				_ = wr.blank()
+			}
+			_ = wr.Emit(ent.Entry)
+		}
+	}
+	err := wr.Close()
+	return wr.ew.n, err
+}
@@ -0,0 +1,576 @@
+package ini
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/errs/v2"
+)
+
+func TestDocument(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"top = level",
+		"[a]",
+		"foo = 1",
+		"foo = 2",
+		"[b]",
+		"bar = baz",
+		"[a]",
+		"baz = 3",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	value, ok := d.Get("a", "foo")
+	assert.That(t, ok)
+	assert.Equal(t, value, "2")
+
+	value, ok = d.Get("", "top")
+	assert.That(t, ok)
+	assert.Equal(t, value, "level")
+
+	_, ok = d.Get("a", "missing")
+	assert.That(t, !ok)
+	_, ok = d.Get("missing", "foo")
+	assert.That(t, !ok)
+
+	d.Set("a", "foo", "updated")
+	d.Set("b", "new", "value")
+	d.Set("c", "created", "section")
+
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(buf.Len()))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"top = level",
+		"",
+		"[a]",
+		"foo = 1",
+		"foo = updated",
+		"baz = 3",
+		"",
+		"[b]",
+		"bar = baz",
+		"new = value",
+		"",
+		"[c]",
+		"created = section",
+		"",
+	}, "\n"))
+}
+
+func TestDocument_Typed(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"[s]",
+		"int = -12",
+		"big = 9000000000",
+		"float = 1.5",
+		"yes = YES",
+		"off = Off",
+		"zero = 0",
+		"bad = nope",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	i, err := d.GetInt("s", "big")
+	assert.NoError(t, err)
+	assert.Equal(t, i, int64(9000000000))
+	i, err = d.GetInt("s", "int")
+	assert.NoError(t, err)
+	assert.Equal(t, i, int64(-12))
+
+	f, err := d.GetFloat64("s", "float")
+	assert.NoError(t, err)
+	assert.Equal(t, f, 1.5)
+
+	for key, exp := range map[string]bool{"yes": true, "off": false, "zero": false} {
+		b, err := d.GetBool("s", key)
+		assert.NoError(t, err)
+		assert.Equal(t, b, exp)
+	}
+
+	_, err = d.GetInt("s", "bad")
+	assert.Error(t, err)
+	assert.That(t, strings.Contains(err.Error(), `section "s" key "bad"`))
+	assert.That(t, !errors.Is(err, ErrKeyNotFound))
+	_, err = d.GetBool("s", "bad")
+	assert.That(t, strings.Contains(err.Error(), `section "s" key "bad"`))
+	_, err = d.GetFloat64("s", "bad")
+	assert.That(t, strings.Contains(err.Error(), `section "s" key "bad"`))
+
+	_, err = d.GetInt("s", "missing")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+	_, err = d.GetBool("missing", "yes")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+	_, err = d.GetFloat64("", "float")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestDocument_Default(t *testing.T) {
+	d, err := Parse(strings.NewReader("[s]\nint = 3\nbool = on\nfloat = 2.5\nempty =\nbad = nope"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, d.GetDefault("s", "int", "x"), "3")
+	assert.Equal(t, d.GetDefault("s", "empty", "x"), "")
+	assert.Equal(t, d.GetDefault("s", "missing", "x"), "x")
+
+	assert.Equal(t, d.GetIntDefault("s", "int", 7), int64(3))
+	assert.Equal(t, d.GetIntDefault("s", "missing", 7), int64(7))
+	assert.Equal(t, d.GetIntDefault("s", "bad", 7), int64(7))
+
+	assert.Equal(t, d.GetBoolDefault("s", "bool", false), true)
+	assert.Equal(t, d.GetBoolDefault("s", "missing", true), true)
+	assert.Equal(t, d.GetBoolDefault("s", "bad", true), true)
+
+	assert.Equal(t, d.GetFloat64Default("s", "float", 1), 2.5)
+	assert.Equal(t, d.GetFloat64Default("missing", "float", 1), 1.0)
+	assert.Equal(t, d.GetFloat64Default("s", "bad", 1), 1.0)
+}
+
+func TestDocument_List(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"items = a, b, c",
+		"quoted = x, \"a, b\",  c ,\" d \"",
+		"single = a",
+		"empty =",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.DeepEqual(t, d.GetList("", "items", ","), []string{"a", "b", "c"})
+	assert.DeepEqual(t, d.GetList("", "quoted", ","), []string{"x", "a, b", "c", " d "})
+	assert.DeepEqual(t, d.GetList("", "single", ","), []string{"a"})
+	assert.That(t, d.GetList("", "empty", ",") == nil)
+	assert.That(t, d.GetList("", "missing", ",") == nil)
+
+	list := []string{"plain", "with, comma", ` spaced `, `"quoted"`, `back\slash`, ""}
+	d.SetList("s", "list", ", ", list)
+	assert.DeepEqual(t, d.GetList("s", "list", ","), list)
+
+	var buf bytes.Buffer
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	d, err = Parse(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, d.GetList("s", "list", ","), list)
+	assert.DeepEqual(t, d.GetList("", "items", ","), []string{"a", "b", "c"})
+}
+
+func TestDocument_SectionsKeys(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"top = 1",
+		"[b]",
+		"z = 1",
+		"a = 2",
+		"[a]",
+		"only = 3",
+		"[b]",
+		"z = 4",
+		"m = 5",
+		"[empty]",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.DeepEqual(t, d.Sections(), []string{"", "b", "a"})
+	assert.DeepEqual(t, d.Keys(""), []string{"top"})
+	assert.DeepEqual(t, d.Keys("b"), []string{"z", "a", "m"})
+	assert.DeepEqual(t, d.Keys("a"), []string{"only"})
+	assert.Equal(t, len(d.Keys("missing")), 0)
+
+	d.FoldCase = true
+	d.Set("B", "Z", "6")
+	d.Set("B", "new", "7")
+	assert.DeepEqual(t, d.Keys("B"), []string{"z", "a", "m", "new"})
+
+	d.Delete("", "top")
+	assert.DeepEqual(t, d.Sections(), []string{"b", "a"})
+}
+
+func TestDocument_Delete(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"[a]",
+		"foo = 1",
+		"# kept",
+		"bar = 2",
+		"foo = 3",
+		"baz = 4",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	d.Set("a", "bar", "updated")
+	assert.That(t, d.Delete("a", "foo"))
+	assert.That(t, !d.Delete("a", "foo"))
+	assert.That(t, !d.Delete("b", "foo"))
+
+	_, ok := d.Get("a", "foo")
+	assert.That(t, !ok)
+
+	var buf bytes.Buffer
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), "[a]\n# kept\nbar = updated\nbaz = 4\n")
+}
+
+func TestDocument_DeleteSection(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"top = 1",
+		"[a]",
+		"foo = 2",
+		"[b]",
+		"bar = 3",
+		"[a]",
+		"baz = 4",
+		"[c]",
+		"qux = 5",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.That(t, d.DeleteSection("a"))
+	assert.That(t, !d.DeleteSection("a"))
+	assert.That(t, !d.DeleteSection("missing"))
+	assert.That(t, d.Delete("c", "qux"))
+	assert.That(t, !d.DeleteSection("c"))
+
+	_, ok := d.Get("a", "foo")
+	assert.That(t, !ok)
+	assert.DeepEqual(t, d.Sections(), []string{"", "b"})
+
+	var buf bytes.Buffer
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), "top = 1\n\n[b]\nbar = 3\n")
+}
+
+func TestDocument_RenameSection(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"[a]",
+		"z = 1",
+		"y = 2",
+		"[b]",
+		"x = 3",
+		"[a]",
+		"w = 4",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.RenameSection("a", "c"))
+	assert.DeepEqual(t, d.Sections(), []string{"c", "b"})
+	assert.DeepEqual(t, d.Keys("c"), []string{"z", "y", "w"})
+	_, ok := d.Get("a", "z")
+	assert.That(t, !ok)
+
+	var buf bytes.Buffer
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), "[c]\nz = 1\ny = 2\nw = 4\n\n[b]\nx = 3\n")
+
+	err = d.RenameSection("c", "b")
+	assert.That(t, errors.Is(err, errs.Tag("section exists")))
+	err = d.RenameSection("missing", "d")
+	assert.That(t, errors.Is(err, errs.Tag("section not found")))
+
+	d.Delete("b", "x")
+	assert.NoError(t, d.RenameSection("c", "b"))
+	assert.DeepEqual(t, d.Sections(), []string{"b"})
+
+	d.FoldCase = true
+	assert.NoError(t, d.RenameSection("b", "B"))
+	assert.DeepEqual(t, d.Sections(), []string{"B"})
+}
+
+func TestDocument_GetAll(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"include = a",
+		"other = x",
+		"include = b",
+		"include = c",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.DeepEqual(t, d.GetAll("", "include"), []string{"a", "b", "c"})
+	assert.DeepEqual(t, d.GetAll("", "other"), []string{"x"})
+	assert.DeepEqual(t, d.GetAll("", "missing"), []string(nil))
+	assert.DeepEqual(t, d.GetAll("missing", "include"), []string(nil))
+
+	value, ok := d.Get("", "include")
+	assert.That(t, ok)
+	assert.Equal(t, value, "c")
+}
+
+func TestDocument_FoldCase(t *testing.T) {
+	d, err := Parse(strings.NewReader("[Server]\nHost = localhost\nPort = 80"))
+	assert.NoError(t, err)
+
+	_, ok := d.Get("server", "host")
+	assert.That(t, !ok)
+
+	d.FoldCase = true
+
+	value, ok := d.Get("SERVER", "host")
+	assert.That(t, ok)
+	assert.Equal(t, value, "localhost")
+
+	d.Set("server", "PORT", "8080")
+	d.Set("SeRvEr", "new", "key")
+	assert.That(t, d.Delete("server", "HOST"))
+
+	var buf bytes.Buffer
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), "[Server]\nPort = 8080\nnew = key\n")
+}
+
+func TestDocument_Index(t *testing.T) {
+	var d Document
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 100; j++ {
+			d.Set(fmt.Sprintf("s%d", i), fmt.Sprintf("k%d", j), fmt.Sprint(i*j))
+		}
+	}
+	value, ok := d.Get("s99", "k42")
+	assert.That(t, ok)
+	assert.Equal(t, value, "4158")
+
+	assert.That(t, d.Delete("s99", "k42"))
+	_, ok = d.Get("s99", "k42")
+	assert.That(t, !ok)
+	value, ok = d.Get("s99", "k43")
+	assert.That(t, ok)
+	assert.Equal(t, value, "4257")
+
+	assert.That(t, d.DeleteSection("s98"))
+	_, ok = d.Get("s98", "k0")
+	assert.That(t, !ok)
+
+	assert.NoError(t, d.RenameSection("s97", "renamed"))
+	_, ok = d.Get("s97", "k1")
+	assert.That(t, !ok)
+	value, ok = d.Get("renamed", "k1")
+	assert.That(t, ok)
+	assert.Equal(t, value, "97")
+
+	d.Set("Renamed", "K1", "upper")
+	value, _ = d.Get("renamed", "k1")
+	assert.Equal(t, value, "97")
+
+	d.FoldCase = true
+	value, _ = d.Get("RENAMED", "k1")
+	assert.Equal(t, value, "97")
+	value, _ = d.Get("s0", "\u212a1") // KELVIN SIGN folds to k
+	assert.Equal(t, value, "0")
+
+	d.FoldCase = false
+	value, _ = d.Get("Renamed", "K1")
+	assert.Equal(t, value, "upper")
+}
+
+func TestMerge(t *testing.T) {
+	base, err := Parse(strings.NewReader(strings.Join([]string{
+		"name = base",
+		"[server]",
+		"# the host",
+		"host = localhost",
+		"port = 80",
+		"[log]",
+		"level = info",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	override, err := Parse(strings.NewReader(strings.Join([]string{
+		"[extra]",
+		"key = value",
+		"[server]",
+		"port = 8080",
+		"tls = true",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	merged := Merge(base, nil, override)
+
+	var buf bytes.Buffer
+	_, err = merged.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"name = base",
+		"",
+		"[server]",
+		"# the host",
+		"host = localhost",
+		"port = 8080",
+		"tls = true",
+		"",
+		"[log]",
+		"level = info",
+		"",
+		"[extra]",
+		"key = value",
+		"",
+	}, "\n"))
+
+	merged.Set("server", "port", "9090")
+	value, _ := base.Get("server", "port")
+	assert.Equal(t, value, "80")
+	value, _ = override.Get("server", "port")
+	assert.Equal(t, value, "8080")
+
+	assert.Equal(t, len(Merge().sections), 0)
+}
+
+func TestMerge_Repeated(t *testing.T) {
+	doc, err := Parse(strings.NewReader("# first\nlist = a\nlist = b\nother = x\nlist = c\n"))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, doc.GetAll("", "list"), []string{"a", "b", "c"})
+
+	merged := Merge(doc)
+	assert.DeepEqual(t, merged.GetAll("", "list"), []string{"c"})
+
+	var buf bytes.Buffer
+	_, err = merged.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), "# first\nlist = c\nother = x\n")
+}
+
+func TestMerge_Comments(t *testing.T) {
+	base, err := Parse(strings.NewReader(strings.Join([]string{
+		"# base a",
+		"a = 1",
+		"# base b",
+		"b = 2",
+		"# base c",
+		"c = 3",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	override, err := Parse(strings.NewReader(strings.Join([]string{
+		"# override a",
+		"a = 10",
+		"b = 20",
+		"# override d",
+		"d = 40",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	merged := Merge(base, override)
+	assert.DeepEqual(t, merged.sections[0].entries, []docEntry{
+		{Entry: Entry{Key: "a", Value: "10", Comment: "override a"}},
+		{Entry: Entry{Key: "b", Value: "20", Comment: "base b"}},
+		{Entry: Entry{Key: "c", Value: "3", Comment: "base c"}},
+		{Entry: Entry{Key: "d", Value: "40", Comment: "override d"}},
+	})
+}
+
+func TestDocument_RoundTrip(t *testing.T) {
+	for _, test := range tests {
+		d, err := Parse(test.Reader())
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		_, err = d.WriteTo(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(buf.String()), test.NormalizedData())
+	}
+
+	data := strings.Join([]string{
+		"# top comment",
+		"top = level",
+		"",
+		"[a]",
+		"# multi",
+		"# line",
+		"foo = \"  padded  \"",
+		"bar = \"multi\\nline\"",
+		"",
+	}, "\n")
+
+	d, err := Parse(strings.NewReader(data))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(len(data)))
+	assert.Equal(t, buf.String(), data)
+}
+
+func TestDocument_BlankLines(t *testing.T) {
+	d, err := Parse(strings.NewReader(strings.Join([]string{
+		"",
+		"a = 1",
+		"",
+		"",
+		"b = 2",
+		"",
+		"# comment",
+		"c = 3",
+		"",
+		"[s]",
+		"",
+		"d = 4",
+		"",
+		"e = 5",
+		"",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"a = 1",
+		"",
+		"",
+		"b = 2",
+		"",
+		"# comment",
+		"c = 3",
+		"",
+		"[s]",
+		"d = 4",
+		"",
+		"e = 5",
+		"",
+	}, "\n"))
+
+	d.CollapseBlankLines = true
+	d.Delete("", "a")
+	d.Set("s", "f", "6")
+
+	buf.Reset()
+	_, err = d.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"b = 2",
+		"",
+		"# comment",
+		"c = 3",
+		"",
+		"[s]",
+		"d = 4",
+		"",
+		"e = 5",
+		"f = 6",
+		"",
+	}, "\n"))
+}
+
+func TestDocument_WriterTo(t *testing.T) {
+	d, err := Parse(strings.NewReader("a = 1\n\n[s]\nb = 2\n"))
+	assert.NoError(t, err)
+
+	var wt io.WriterTo = d
+	var buf bytes.Buffer
+	n, err := wt.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(buf.Len()))
+	assert.Equal(t, buf.String(), "a = 1\n\n[s]\nb = 2\n")
+
+	lw := &limitWriter{limit: 8}
+	n, err = d.WriteTo(lw)
+	assert.Equal(t, err, errLimit)
+	assert.Equal(t, n, int64(8))
+}
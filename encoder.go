@@ -0,0 +1,27 @@
+package ini
+
+import "io"
+
+// Encoder writes entries to an output stream one at a time, writing a
+// section declaration whenever the section changes. It is a thin wrapper
+// around a Writer.
+type Encoder struct {
+	w *Writer
+}
+
+// NewEncoder returns an Encoder that writes entries to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: NewWriter(w)}
+}
+
+// Encode writes the entry. Once a write fails, every later call returns the
+// error without writing.
+func (e *Encoder) Encode(ent Entry) error {
+	return e.w.Emit(ent)
+}
+
+// Close writes any buffered entries and returns the first error from
+// writing, if any. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	return e.w.Close()
+}
@@ -0,0 +1,36 @@
+package ini
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	for _, test := range tests {
+		var exp, got bytes.Buffer
+		assert.NoError(t, Write(&exp, func(emit func(ent Entry)) {
+			for _, ent := range test.Entries {
+				emit(ent)
+			}
+		}))
+
+		enc := NewEncoder(&got)
+		for _, ent := range test.Entries {
+			assert.NoError(t, enc.Encode(ent))
+		}
+		assert.NoError(t, enc.Close())
+
+		assert.Equal(t, got.String(), exp.String())
+	}
+}
+
+func TestEncoder_Error(t *testing.T) {
+	fail := errors.New("fail")
+	enc := NewEncoder(failWriter{err: fail})
+	assert.Equal(t, enc.Encode(Entry{Key: "a", Value: "b"}), fail)
+	assert.Equal(t, enc.Encode(Entry{Key: "c", Value: "d"}), fail)
+	assert.Equal(t, enc.Close(), fail)
+}
@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package ini
+
+import (
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, test := range tests {
+		f.Add([]byte(test.String()))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, err := RoundTrip(data)
+		if err != nil {
+			return
+		}
+
+		var exp []Entry
+		assert.NoError(t, ReadBytes(data, func(ent Entry) error {
+			if ent.Validate() != nil {
+				t.Skip("entry does not round trip:", ent)
+			}
+			exp = append(exp, ent)
+			return nil
+		}))
+
+		var got []Entry
+		assert.NoError(t, ReadBytes(out, func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, exp)
+	})
+}
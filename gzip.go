@@ -0,0 +1,43 @@
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// gzipMagic begins every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ReadMaybeCompressed is like Read but decompresses r first if it begins with
+// the gzip magic bytes. The start of r is peeked through a bufio.Reader, so
+// an uncompressed stream is parsed in full.
+//
+// It and ReadGzip use the standard library's compress/gzip package, so that
+// package is linked into every program that imports this one, whether or
+// not it reads compressed input.
+func ReadMaybeCompressed(r io.Reader, cb func(ent Entry) error) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return errs.Tag("read").Wrap(err)
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return Read(br, cb)
+	}
+	return ReadGzip(br, cb)
+}
+
+// ReadGzip is like Read but decompresses r as a gzip stream first. See
+// ReadMaybeCompressed for the dependency on compress/gzip this adds.
+func ReadGzip(r io.Reader, cb func(ent Entry) error) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return errs.Tag("read").Errorf("invalid gzip stream: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+	return Read(zr, cb)
+}
@@ -0,0 +1,71 @@
+package ini
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/errs/v2"
+)
+
+func TestReadMaybeCompressed(t *testing.T) {
+	data := "a = 1\n[s]\nb = 2\n"
+	want, err := ReadAll(strings.NewReader(data))
+	assert.NoError(t, err)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	for _, r := range []io.Reader{
+		strings.NewReader(data),
+		bytes.NewReader(compressed.Bytes()),
+		iotest.OneByteReader(bytes.NewReader(compressed.Bytes())),
+	} {
+		var got []Entry
+		assert.NoError(t, ReadMaybeCompressed(r, func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, want)
+	}
+
+	err = ReadMaybeCompressed(strings.NewReader(""), func(ent Entry) error { return nil })
+	assert.NoError(t, err)
+
+	err = ReadMaybeCompressed(bytes.NewReader(compressed.Bytes()[:compressed.Len()-4]), func(ent Entry) error { return nil })
+	assert.That(t, errors.Is(err, errs.Tag("read")))
+
+	fail := errors.New("fail")
+	err = ReadMaybeCompressed(failReader{err: fail}, func(ent Entry) error { return nil })
+	assert.That(t, errors.Is(err, fail))
+}
+
+func TestReadGzip(t *testing.T) {
+	for _, test := range tests {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		_, err := zw.Write([]byte(test.String()))
+		assert.NoError(t, err)
+		assert.NoError(t, zw.Close())
+
+		var got []Entry
+		assert.NoError(t, ReadGzip(&compressed, func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, test.Entries)
+	}
+
+	err := ReadGzip(strings.NewReader("a = 1\nb = 2\nc = 3\n"), func(ent Entry) error { return nil })
+	assert.That(t, errors.Is(err, errs.Tag("read")))
+	assert.That(t, errors.Is(err, gzip.ErrHeader))
+	assert.That(t, strings.Contains(err.Error(), "invalid gzip stream"))
+}
@@ -4,11 +4,11 @@
 //
 // Entries:
 //
-// 0. an entry contains three fields
+// 0. an entry contains four fields
 //    a. section of type string
-//    a. key of type string
-//    b. value of type string
-//    c. comment of type string
+//    b. key of type string
+//    c. value of type string
+//    d. comment of type string
 //
 // Parser state:
 //
@@ -18,94 +18,278 @@
 // Parser semantics:
 //
 // 0. the byte stream is broken up into lines
-//    a. lines are split by the separator regex '\r?\n'
-//    b. a separator may be escaped with '\' causing it not to split
-//    c. an escaping '\' is removed from the contents of the line
-//    d. the line is always joined with '\n'
+//    a. a leading UTF-8 byte order mark is removed from the byte stream
+//    b. lines are split by the separator regex '\r?\n'
+//    c. a separator may be escaped with '\' causing it not to split
+//    d. an escaping '\' is removed from the contents of the line
+//    e. the line is always joined with '\n'
 //
-// 1. lines beginning with '#' are comments and are ignored
+// 1. lines whose first non-space byte is '#' are comments
+//    a. the leading space, the '#', and a single following ' ', if it exists,
+//       are removed
+//    b. the remaining contents and a '\n' are appended to the comment state
 //
 // 2. empty space trimmed lines are valid and ignored
 //
-// 3. lines beginning with '[' and ending with ']' are section declarations
+// 3. lines beginning with '[' and ending with ']' are section declarations,
+//    even if they contain "=", so an entry like that must escape its '['
 //    a. the line is invalid if the contents contain '[', ']', '\', '=', or '#'
+//       that is not escaped with '\'
 //    b. the contents between the '[' and ']' become the section
-//    c. the comment state is reset to empty
+//    c. a '\' in the section followed by one of those bytes is removed and
+//       the byte following it is kept
+//    d. the comment state is reset to empty
 //
 // 4. lines containing the string "=" are entries
-//    a. the entry key is the space trimmed portion before the first "="
-//    b. the entry value is the space trimmed portion after the first "="
-//    c. the comment state has the final '\n' removed, if it exists
-//    d. entries are immediately emitted
-//    e. when an entry is emitted, the comment state is reset to empty
+//    a. an "=" escaped with '\' does not count as one
+//    b. the entry key is the space trimmed portion before the first "="
+//    c. a '\' in the key followed by '[', ']', '\', '=', or '#' is removed
+//       and the byte following it is kept, and then if the key begins and
+//       ends with '"', it is unquoted the same way as a value in e
+//    d. the entry value is the space trimmed portion after the first "="
+//    e. if the value begins and ends with '"', they are removed and the
+//       contents between them are kept verbatim except for the escapes
+//       '\n', '\r', '\t', '\\', and '\"'
+//    f. lines are joined before quotes are considered, so a quoted value
+//       may span lines and keeps the joining '\n' and any space around it
+//    g. the comment state has the final '\n' removed, if it exists
+//    h. entries are immediately emitted
+//    i. when an entry is emitted, the comment state is reset to empty
 //
 // 5. anything else is an invalid line
 //    a. invalid lines causes Read to return an error
+//    b. the error includes the number of the line the invalid line began on
 package ini
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 
 	"github.com/zeebo/errs/v2"
 )
 
+// Entry is a key and value along with the section it was declared in and
+// the comment lines that immediately preceded it.
 type Entry struct {
 	Section string
 	Key     string
 	Value   string
+	Comment string
 }
 
-func Read(r io.Reader, cb func(ent Entry) error) error {
-	var linebuf []byte = make([]byte, 0, 64)
-	var ent Entry
+// Equal returns true if the entries have the same fields.
+func (e Entry) Equal(other Entry) bool {
+	return e == other
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		linebuf = append(linebuf, scanner.Bytes()...)
+// String returns the entry as Write would write it, with its comment lines
+// followed by the entry line, but without a trailing newline. If the entry
+// has a section, the entry line is prefixed with it in brackets, escaped the
+// same way as a section declaration, as in "[section] key = value".
+func (e Entry) String() string {
+	var b strings.Builder
+	if len(e.Comment) > 0 {
+		writeComment(&b, e.Comment, "\n")
+	}
+	if e.Section != "" {
+		fmt.Fprintf(&b, "[%s] ", escape(escapeSection(e.Section, '='), "\n"))
+	}
+	writeEntry(&b, WriteOptions{}, Entry{Key: e.Key, Value: e.Value}, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
 
-		if len(linebuf) == 0 || len(bytes.TrimSpace(linebuf)) == 0 {
-			continue
+// Validate returns an error if writing the entry with Write would not read
+// back as the same entry.
+func (e Entry) Validate() error {
+	invalid := errs.Tag("invalid entry")
+	for _, line := range strings.Split(e.Comment, "\n") {
+		if strings.HasSuffix(line, `\`) {
+			return invalid.Errorf("section %q key %q comment line ends with '\\'", e.Section, e.Key)
 		}
-
-		if linebuf[len(linebuf)-1] == '\\' {
-			linebuf[len(linebuf)-1] = '\n'
-			continue
+		if strings.HasSuffix(line, "\r") {
+			return invalid.Errorf("section %q key %q comment line ends with '\\r'", e.Section, e.Key)
 		}
+	}
+	return nil
+}
 
-		if linebuf[0] == '#' {
-			linebuf = linebuf[:0]
-			continue
+// ParseError is returned, wrapped with the "invalid line" tag, when Read
+// encounters an invalid line. Reason is empty unless the line looked like a
+// section or entry but broke a rule of it. It is returned as a pointer, so
+// inspect it with
+//
+//	var perr *ParseError
+//	if errors.As(err, &perr) {
+//		...
+//	}
+type ParseError struct {
+	Line    int
+	Content string
+	Reason  string
+}
+
+func (p *ParseError) Error() string {
+	if p.Reason != "" {
+		return fmt.Sprintf("line %d: %s: %q", p.Line, p.Reason, p.Content)
+	}
+	return fmt.Sprintf("line %d: %q", p.Line, p.Content)
+}
+
+// Pos is the position of the logical line that produced an entry: its line
+// number, counting from 1, and the byte offset of its start, counting from 0
+// and including any line endings, continuations, and byte order mark before
+// it.
+type Pos struct {
+	Line   int
+	Offset int64
+}
+
+// Read parses r according to the package specification, calling cb with
+// every emitted entry. It is the same as ReadWith with the zero ReadOptions.
+func Read(r io.Reader, cb func(ent Entry) error) error {
+	return ReadWith(r, ReadOptions{}, cb)
+}
+
+// ReadWith is like Read but parses according to the options.
+func ReadWith(r io.Reader, opts ReadOptions, cb func(ent Entry) error) error {
+	return readDecoder(newDecoder(r, opts), cb)
+}
+
+// ErrStop can be returned by the callback of any of the Read functions to
+// stop reading without an error, so that they return nil.
+var ErrStop = errors.New("stop")
+
+// readDecoder calls cb with every entry from dec, closing any included files
+// once it returns.
+func readDecoder(dec *Decoder, cb func(ent Entry) error) error {
+	defer dec.close()
+
+	for {
+		ent, err := dec.Next()
+		if err == io.EOF || errors.Is(err, ErrStop) {
+			return nil
+		} else if err != nil {
+			return err
 		}
+		if err := cb(ent); errors.Is(err, ErrStop) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
 
-		if linebuf[0] == '[' && linebuf[len(linebuf)-1] == ']' {
-			ent.Section = string(linebuf[1 : len(linebuf)-1])
-			linebuf = linebuf[:0]
-			continue
+// ReadContext is like Read but stops with the error of ctx once it is done.
+// The context is checked before every line, so a call to r that blocks is not
+// interrupted by it.
+func ReadContext(ctx context.Context, r io.Reader, cb func(ent Entry) error) error {
+	dec := newDecoder(r, ReadOptions{})
+	dec.ctx = ctx
+	return readDecoder(dec, cb)
+}
+
+// ReadString is like Read but parses the contents of s.
+func ReadString(s string, cb func(ent Entry) error) error {
+	return Read(strings.NewReader(s), cb)
+}
+
+// ReadBytes is like Read but parses the contents of b. It splits lines
+// directly from b instead of copying them through a bufio.Scanner, so it has
+// no maximum line size.
+func ReadBytes(b []byte, cb func(ent Entry) error) error {
+	return readDecoder(newLinesDecoder(&byteLines{data: b}, ReadOptions{}), cb)
+}
+
+// ReadAll reads every entry from r and returns them in order, including any
+// duplicates. If an error occurs, the entries read before it are returned
+// along with the error.
+func ReadAll(r io.Reader) (ents []Entry, err error) {
+	err = Read(r, func(ent Entry) error {
+		ents = append(ents, ent)
+		return nil
+	})
+	return ents, err
+}
+
+// ReadSection is like Read but only calls cb with the entries in section.
+// Because a section may be declared more than once, all of r is read even
+// after the section ends. Return an error from cb to stop early.
+func ReadSection(r io.Reader, section string, cb func(ent Entry) error) error {
+	return Read(r, func(ent Entry) error {
+		if ent.Section != section {
+			return nil
 		}
+		return cb(ent)
+	})
+}
 
-		if idx := bytes.IndexByte(linebuf, '='); idx >= 0 {
-			ent.Key = string(bytes.TrimSpace(linebuf[:idx]))
-			ent.Value = string(bytes.TrimSpace(linebuf[idx+1:]))
-			if err := cb(ent); err != nil {
-				return err
+// ReadPos is like Read but also calls cb with the position of every entry.
+func ReadPos(r io.Reader, cb func(ent Entry, pos Pos) error) error {
+	dec := newDecoder(r, ReadOptions{})
+	return readDecoder(dec, func(ent Entry) error {
+		return cb(ent, dec.Pos())
+	})
+}
+
+// Validate reads all of r and returns an error for every invalid line in it
+// instead of stopping at the first one. If reading fails for any other
+// reason, that error is the last one returned.
+func Validate(r io.Reader) (failures []error) {
+	dec := newDecoder(r, ReadOptions{})
+	dec.resume = true
+	for {
+		_, err := dec.Next()
+		if err == io.EOF {
+			return failures
+		} else if err != nil {
+			failures = append(failures, err)
+			if dec.err != nil {
+				return failures
 			}
-			linebuf = linebuf[:0]
-			continue
 		}
+	}
+}
+
+// RoundTrip is the same as Normalize. It is meant to be the core of a fuzz
+// test: when every entry is valid according to Entry.Validate, reading the
+// output must produce the same entries as reading data.
+func RoundTrip(data []byte) ([]byte, error) {
+	return Normalize(data)
+}
 
-		return errs.Tag("invalid line").Errorf("%q", linebuf)
+// Normalize reads every entry from data and writes them back with Write,
+// producing a canonical form that is useful for comparing configurations.
+// Inputs with the same entries normalize to the same output, regardless of
+// their spacing, comment style, quoting, or repeated section declarations.
+// Comments before a section declaration are dropped.
+func Normalize(data []byte) ([]byte, error) {
+	var ents []Entry
+	err := ReadBytes(data, func(ent Entry) error {
+		ents = append(ents, ent)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return scanner.Err()
+	var buf bytes.Buffer
+	err = Write(&buf, func(emit func(ent Entry)) {
+		for _, ent := range ents {
+			emit(ent)
+		}
+	})
+	return buf.Bytes(), err
 }
 
 type errWriter struct {
 	err error
 	w   io.Writer
+	n   int64
 }
 
 func (e *errWriter) Write(p []byte) (n int, err error) {
@@ -113,37 +297,311 @@ func (e *errWriter) Write(p []byte) (n int, err error) {
 		return 0, e.err
 	}
 	n, e.err = e.w.Write(p)
+	e.n += int64(n)
 	return n, e.err
 }
 
 func Write(w io.Writer, cb func(emit func(ent Entry))) error {
-	var section string
-	var wrote bool
-	ew := &errWriter{w: w}
+	_, err := WriteCount(w, cb)
+	return err
+}
 
-	cb(func(ent Entry) {
-		if ent.Section != section {
-			if wrote {
-				fmt.Fprintln(ew)
+// WriteCount is like Write but also returns the number of bytes written
+// before any error.
+func WriteCount(w io.Writer, cb func(emit func(ent Entry))) (int64, error) {
+	return writeCount(w, WriteOptions{}, cb)
+}
+
+// WriteGrouped writes the entries grouped by section so that every section
+// is declared once. Sections are written in the order they first appear and
+// the entries within a section keep their order.
+func WriteGrouped(w io.Writer, ents []Entry) error {
+	var sections []string
+	grouped := make(map[string][]Entry)
+	for _, ent := range ents {
+		if _, ok := grouped[ent.Section]; !ok {
+			sections = append(sections, ent.Section)
+		}
+		grouped[ent.Section] = append(grouped[ent.Section], ent)
+	}
+
+	return Write(w, func(emit func(ent Entry)) {
+		for _, section := range sections {
+			for _, ent := range grouped[section] {
+				emit(ent)
 			}
-			fmt.Fprintf(ew, "[%s]\n", escape(ent.Section))
-			section = ent.Section
 		}
-		if len(ent.Key) > 0 {
-			fmt.Fprintf(ew, "%s ", escape(ent.Key))
+	})
+}
+
+// AppendEntries writes the entries to w as if they continued an existing
+// file that w is positioned at the end of, declaring a section only when it
+// differs from the section before it. The caller is responsible for passing
+// the section in effect at the end of the file as lastSection, which is the
+// empty section if the file declares none, and for the file ending in a
+// newline. Passing the wrong section causes the first entries to be written
+// in the wrong section or under a redundant declaration.
+func AppendEntries(w io.Writer, lastSection string, ents []Entry) error {
+	wr := newWriter(w, WriteOptions{})
+	wr.section, wr.wrote = lastSection, true
+	for _, ent := range ents {
+		_ = wr.Emit(ent)
+	}
+	return wr.Close()
+}
+
+// WriteWith is like Write but formats according to the options.
+func WriteWith(w io.Writer, opts WriteOptions, cb func(emit func(ent Entry))) error {
+	_, err := writeCount(w, opts, cb)
+	return err
+}
+
+// writeCount writes the entries emitted by cb to w according to opts and
+// returns the number of bytes written.
+func writeCount(w io.Writer, opts WriteOptions, cb func(emit func(ent Entry))) (int64, error) {
+	wr := newWriter(w, opts)
+	cb(func(ent Entry) { _ = wr.Emit(ent) })
+	err := wr.Close()
+	return wr.ew.n, err
+}
+
+// stripInlineComment removes anything after the first whitespace followed
+// by a comment prefix that is not inside of a quoted value and returns it as
+// the comment, without the prefix and a single following ' '. Comment
+// prefixes escaped with '\' outside of a quoted value have the '\' removed.
+func stripInlineComment(x, prefixes []byte) (value, comment []byte) {
+	out := make([]byte, 0, len(x))
+	trimmed := bytes.TrimLeftFunc(x, unicode.IsSpace)
+	quoted := len(trimmed) > 0 && trimmed[0] == '"'
+	open := len(x) - len(trimmed)
+
+	for i := 0; i < len(x); i++ {
+		c := x[i]
+		next := byte(0)
+		if i+1 < len(x) {
+			next = x[i+1]
 		}
-		fmt.Fprint(ew, "=")
-		if len(ent.Value) > 0 {
-			fmt.Fprintf(ew, " %s", escape(ent.Value))
+
+		switch {
+		case quoted && c == '\\' && i+1 < len(x):
+			out = append(out, c, next)
+			i++
+			continue
+
+		case quoted:
+			quoted = i == open || c != '"'
+
+		case c == '\\' && bytes.IndexByte(prefixes, next) >= 0:
+			out = append(out, next)
+			i++
+			continue
+
+		case (c == ' ' || c == '\t') && bytes.IndexByte(prefixes, next) >= 0:
+			comment = x[i+2:]
+			if len(comment) > 0 && comment[0] == ' ' {
+				comment = comment[1:]
+			}
+			return out, comment
 		}
-		fmt.Fprint(ew, "\n")
 
-		wrote = true
-	})
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// indexUnescaped returns the index of the first c in x that is not escaped
+// with '\', or -1.
+func indexUnescaped(x []byte, c byte) int {
+	for i := 0; i < len(x); i++ {
+		switch x[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+// indexReserved returns the index of the first byte in x that is one of
+// reserved and not escaped with '\', or -1.
+func indexReserved(x, reserved []byte) int {
+	for i := 0; i < len(x); i++ {
+		if x[i] == '\\' && i+1 < len(x) && bytes.IndexByte(reserved, x[i+1]) >= 0 {
+			i++
+		} else if bytes.IndexByte(reserved, x[i]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeReserved removes the '\' from any escaped byte in x that is one of
+// escapable.
+func unescapeReserved(x, escapable []byte) []byte {
+	if bytes.IndexByte(x, '\\') < 0 {
+		return x
+	}
+
+	out := make([]byte, 0, len(x))
+	for i := 0; i < len(x); i++ {
+		if x[i] == '\\' && i+1 < len(x) && bytes.IndexByte(escapable, x[i+1]) >= 0 {
+			i++
+		}
+		out = append(out, x[i])
+	}
+	return out
+}
+
+// isQuoted returns true if x begins and ends with '"'.
+func isQuoted(x []byte) bool {
+	return len(x) >= 2 && x[0] == '"' && x[len(x)-1] == '"'
+}
+
+// unquote removes the quotes from a quoted value and interprets any escapes
+// within it.
+func unquote(x []byte) []byte {
+	if !isQuoted(x) {
+		return x
+	}
+	x = x[1 : len(x)-1]
+	if bytes.IndexByte(x, '\\') < 0 {
+		return x
+	}
 
-	return ew.err
+	out := make([]byte, 0, len(x))
+	for i := 0; i < len(x); i++ {
+		if x[i] == '\\' && i+1 < len(x) {
+			switch x[i+1] {
+			case 'n':
+				out = append(out, '\n')
+				i++
+				continue
+			case 'r':
+				out = append(out, '\r')
+				i++
+				continue
+			case 't':
+				out = append(out, '\t')
+				i++
+				continue
+			case '\\', '"':
+				out = append(out, x[i+1])
+				i++
+				continue
+			}
+		}
+		out = append(out, x[i])
+	}
+	return out
+}
+
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// quote wraps the value in quotes, escaping its contents, if reading it back
+// unquoted would trim or unquote it, if it ends with '\' and so would be read
+// as a line continuation, or if it contains a tab, newline or carriage
+// return, which are written as the escapes \t, \n and \r.
+func quote(x string) string {
+	if strings.TrimSpace(x) != x || isQuoted([]byte(x)) ||
+		strings.HasSuffix(x, `\`) || strings.ContainsAny(x, "\t\n\r") {
+		return `"` + quoteReplacer.Replace(x) + `"`
+	}
+	return x
+}
+
+// escapeKey quotes the key if reading it back unquoted would trim or unquote
+// it, or if it begins with a byte order mark, which would be removed if it
+// were written first. It then escapes every '\' and separator in it with '\',
+// as well as a leading '#' or '[' so that it is not read as a comment or
+// section.
+func escapeKey(x string, sep byte) string {
+	if strings.TrimSpace(x) != x || isQuoted([]byte(x)) || strings.HasPrefix(x, "\ufeff") {
+		x = `"` + quoteReplacer.Replace(x) + `"`
+	}
+	if strings.IndexByte(x, '\\') >= 0 || strings.IndexByte(x, sep) >= 0 {
+		var b strings.Builder
+		for i := 0; i < len(x); i++ {
+			if x[i] == '\\' || x[i] == sep {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(x[i])
+		}
+		x = b.String()
+	}
+	if len(x) > 0 && (x[0] == '#' || x[0] == '[') {
+		x = `\` + x
+	}
+	return x
+}
+
+// escapeSection escapes every byte in the section that would otherwise make
+// the section declaration invalid with '\'.
+func escapeSection(x string, sep byte) string {
+	reserved := `[]\#` + string(sep)
+	if strings.IndexAny(x, reserved) < 0 {
+		return x
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(x); i++ {
+		if strings.IndexByte(reserved, x[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(x[i])
+	}
+	return b.String()
+}
+
+// Escape writes every newline in s as a '\' followed by the newline, which
+// is how Write continues a key or section onto the next line.
+func Escape(s string) string {
+	return escape(s, "\n")
+}
+
+// Unescape is the inverse of Escape, removing the '\' before every newline.
+// A '\' before a "\r\n" line ending is removed along with the '\r', as it
+// is by Read.
+func Unescape(s string) string {
+	return unescapeReplacer.Replace(s)
+}
+
+var unescapeReplacer = strings.NewReplacer("\\\r\n", "\n", "\\\n", "\n")
+
+// SplitSection splits a hierarchical section like "a.b.c" into its parts on
+// every '.' that is not escaped with '\'. In the parts, "\." becomes '.' and
+// "\\" becomes '\', and any other '\' is kept. Empty parts are kept, so the
+// empty section is a single empty part.
+func SplitSection(section string) (parts []string) {
+	var b strings.Builder
+	for i := 0; i < len(section); i++ {
+		switch c := section[i]; {
+		case c == '\\' && i+1 < len(section) && (section[i+1] == '.' || section[i+1] == '\\'):
+			i++
+			b.WriteByte(section[i])
+		case c == '.':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(parts, b.String())
+}
+
+var sectionPartReplacer = strings.NewReplacer(`\`, `\\`, `.`, `\.`)
+
+// JoinSection is the inverse of SplitSection, joining the parts with '.'
+// after escaping every '.' and '\' in them with '\'.
+func JoinSection(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = sectionPartReplacer.Replace(part)
+	}
+	return strings.Join(escaped, ".")
 }
 
-func escape(x string) string {
-	return strings.ReplaceAll(x, "\n", "\\\n")
+// escape writes every newline in x as a line continuation ending in nl.
+func escape(x, nl string) string {
+	return strings.ReplaceAll(x, "\n", "\\"+nl)
 }
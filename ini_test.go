@@ -1,12 +1,17 @@
 package ini
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
 
 	"github.com/zeebo/assert"
+	"github.com/zeebo/errs/v2"
 )
 
 func TestRead(t *testing.T) {
@@ -20,6 +25,1256 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestReadWith_ZeroOptions(t *testing.T) {
+	for _, test := range tests {
+		var got []Entry
+		assert.NoError(t, ReadWith(test.Reader(), ReadOptions{}, func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, test.Entries)
+	}
+}
+
+func TestReadString(t *testing.T) {
+	for _, test := range tests {
+		var got []Entry
+		assert.NoError(t, ReadString(test.String(), func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, test.Entries)
+	}
+}
+
+func TestReadBytes(t *testing.T) {
+	for _, test := range tests {
+		var got []Entry
+		assert.NoError(t, ReadBytes([]byte(test.String()), func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, test.Entries)
+	}
+
+	for _, data := range []string{
+		"a = 1\r\nb = 2\r\n",
+		"a = 1\n\r\n\nb = 2",
+		"\xEF\xBB\xBFa = 1\rb = 2",
+		"a = 1\\\r\n2\nb = invalid\ninvalid",
+	} {
+		var got, exp []Entry
+		experr := Read(strings.NewReader(data), func(ent Entry) error {
+			exp = append(exp, ent)
+			return nil
+		})
+		goterr := ReadBytes([]byte(data), func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		})
+		assert.DeepEqual(t, got, exp)
+		assert.Equal(t, fmt.Sprint(goterr), fmt.Sprint(experr))
+	}
+}
+
+func TestReadWith_CommentPrefixes(t *testing.T) {
+	data := "; semicolon\n  # indented\nfoo = bar\n\t; tabbed\nbaz = bif"
+
+	var got []Entry
+	assert.NoError(t, ReadWith(strings.NewReader(data), ReadOptions{
+		CommentPrefixes: []byte{'#', ';'},
+	}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "foo", Value: "bar", Comment: "semicolon\nindented"},
+		{Key: "baz", Value: "bif", Comment: "tabbed"},
+	})
+
+	err := Read(strings.NewReader(data), func(ent Entry) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestRead_Quoted(t *testing.T) {
+	got, err := ReadAll(strings.NewReader(strings.Join([]string{
+		`a = "unquoted"`,
+		`b = ""`,
+		`c = "`,
+		`d = "a\tb\nc"`,
+		`e = a\tb`,
+		`f = "\x\"`,
+		`g = "multi\`,
+		`line "`,
+		`h = "  multi \`,
+		`  line"`,
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "a", Value: "unquoted"},
+		{Key: "b", Value: ""},
+		{Key: "c", Value: `"`},
+		{Key: "d", Value: "a\tb\nc"},
+		{Key: "e", Value: `a\tb`},
+		{Key: "f", Value: `\x\`},
+		{Key: "g", Value: "multi\nline "},
+		{Key: "h", Value: "  multi \n  line"},
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, func(emit func(ent Entry)) {
+		for _, ent := range got {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		`a = unquoted`,
+		`b =`,
+		`c = "`,
+		`d = "a\tb\nc"`,
+		`e = a\tb`,
+		`f = "\\x\\"`,
+		`g = "multi\nline "`,
+		`h = "  multi \n  line"`,
+		``,
+	}, "\n"))
+
+	again, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, again, got)
+}
+
+func TestWrite_TrailingBackslash(t *testing.T) {
+	ents := []Entry{
+		{Key: "path", Value: `C:\`},
+		{Key: "next", Value: "value"},
+		{Key: "multi", Value: "a\\\nb"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, func(emit func(ent Entry)) {
+		for _, ent := range ents {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), "path = \"C:\\\\\"\nnext = value\nmulti = \"a\\\\\\nb\"\n")
+
+	got, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, ents)
+}
+
+func TestWrite_CarriageReturn(t *testing.T) {
+	ents := []Entry{
+		{Key: "a", Value: "x\r"},
+		{Key: "b", Value: "x\ry"},
+		{Key: "c", Value: "x\r\ny"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, func(emit func(ent Entry)) {
+		for _, ent := range ents {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), `a = "x\r"`+"\n"+`b = "x\ry"`+"\n"+`c = "x\r\ny"`+"\n")
+
+	got, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, ents)
+
+	assert.Error(t, Entry{Key: "a", Comment: "x\r"}.Validate())
+}
+
+func TestReadWith_PreserveKeySpace(t *testing.T) {
+	ents := []Entry{
+		{Key: " padded ", Value: "1"},
+		{Key: "trailing\t", Value: "2"},
+		{Key: `"quoted"`, Value: "3"},
+		{Key: "plain", Value: "4"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, func(emit func(ent Entry)) {
+		for _, ent := range ents {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		`" padded " = 1`,
+		`"trailing\\t" = 2`,
+		`"\\"quoted\\"" = 3`,
+		`plain = 4`,
+		``,
+	}, "\n"))
+
+	got, err := ReadAll(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, ents)
+
+	got = nil
+	assert.NoError(t, ReadWith(strings.NewReader("key =1\n key=2\n\"q\" = 3"), ReadOptions{PreserveKeySpace: true}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "key ", Value: "1"},
+		{Key: " key", Value: "2"},
+		{Key: `"q" `, Value: "3"},
+	})
+}
+
+func TestOptions_Separator(t *testing.T) {
+	data := "[a=b]\nurl: http://host/?x=y\n[c]\nk:"
+
+	var got []Entry
+	assert.NoError(t, ReadWith(strings.NewReader(data), ReadOptions{Separator: ':'}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "a=b", Key: "url", Value: "http://host/?x=y"},
+		{Section: "c", Key: "k", Value: ""},
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWith(&buf, WriteOptions{Separator: ':'}, func(emit func(ent Entry)) {
+		for _, ent := range got {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), "[a=b]\nurl : http://host/?x=y\n\n[c]\nk :\n")
+}
+
+func TestReadWith_InlineComments(t *testing.T) {
+	data := strings.Join([]string{
+		`# above`,
+		`a = value  # note`,
+		"b = value\t# note",
+		`c = value#not a note`,
+		`d = value \# not a note`,
+		`e = " quoted # not a note " # note`,
+		`f = "escaped \" # not a note" # note`,
+		`g = # note`,
+	}, "\n")
+
+	var got []Entry
+	assert.NoError(t, ReadWith(strings.NewReader(data), ReadOptions{
+		InlineComments: true,
+	}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "a", Value: "value", Comment: "above\nnote"},
+		{Key: "b", Value: "value", Comment: "note"},
+		{Key: "c", Value: "value#not a note"},
+		{Key: "d", Value: "value # not a note"},
+		{Key: "e", Value: " quoted # not a note ", Comment: "note"},
+		{Key: "f", Value: `escaped " # not a note`, Comment: "note"},
+		{Key: "g", Value: "", Comment: "note"},
+	})
+
+	got, err := ReadAll(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, got[0].Value, "value  # note")
+	assert.Equal(t, got[0].Comment, "above")
+	assert.Equal(t, got[3].Value, `value \# not a note`)
+}
+
+func TestWriteWith(t *testing.T) {
+	ents := []Entry{
+		{Key: "a", Value: "1"},
+		{Key: "bbb", Value: "2", Comment: "note"},
+		{Section: "s", Key: "cc", Value: ""},
+		{Section: "s", Key: "d", Value: "3"},
+	}
+	write := func(opts WriteOptions) string {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteWith(&buf, opts, func(emit func(ent Entry)) {
+			for _, ent := range ents {
+				emit(ent)
+			}
+		}))
+		return buf.String()
+	}
+
+	assert.Equal(t, write(WriteOptions{}), strings.Join([]string{
+		"a = 1",
+		"# note",
+		"bbb = 2",
+		"",
+		"[s]",
+		"cc =",
+		"d = 3",
+		"",
+	}, "\n"))
+
+	assert.Equal(t, write(WriteOptions{AlignKeys: true}), strings.Join([]string{
+		"a   = 1",
+		"# note",
+		"bbb = 2",
+		"",
+		"[s]",
+		"cc =",
+		"d  = 3",
+		"",
+	}, "\n"))
+
+	assert.Equal(t, write(WriteOptions{
+		Compact:            true,
+		AlignKeys:          true,
+		OmitSectionSpacing: true,
+	}), strings.Join([]string{
+		"a  =1",
+		"# note",
+		"bbb=2",
+		"[s]",
+		"cc=",
+		"d =3",
+		"",
+	}, "\n"))
+
+	got, err := ReadAll(strings.NewReader(write(WriteOptions{Compact: true, AlignKeys: true})))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, ents)
+}
+
+func TestRead_BOM(t *testing.T) {
+	got, err := ReadAll(strings.NewReader("\xEF\xBB\xBF[section]\nfoo = bar"))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "section", Key: "foo", Value: "bar"},
+	})
+
+	for _, test := range []struct {
+		data string
+		ents []Entry
+	}{
+		{"\xEF\xBB\xBFfoo = bar", []Entry{{Key: "foo", Value: "bar"}}},
+		{"\xEF\xBB\xBF\xEF\xBB\xBFfoo = bar", []Entry{{Key: "\xEF\xBB\xBFfoo", Value: "bar"}}},
+		{"a = b\n\xEF\xBB\xBFfoo = bar", []Entry{{Key: "a", Value: "b"}, {Key: "\xEF\xBB\xBFfoo", Value: "bar"}}},
+	} {
+		got, err := ReadAll(strings.NewReader(test.data))
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, test.ents)
+
+		got = got[:0]
+		assert.NoError(t, ReadBytes([]byte(test.data), func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, test.ents)
+	}
+}
+
+func TestWriteWith_AlignKeys(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWith(&buf, WriteOptions{AlignKeys: true}, func(emit func(ent Entry)) {
+		emit(Entry{Key: "a", Value: "1"})
+		emit(Entry{Key: "longkey", Value: "2"})
+		emit(Entry{Key: "multi\nline key", Value: "3"})
+		emit(Entry{Section: "s", Key: "a", Value: "4"})
+		emit(Entry{Section: "s", Key: "bb", Value: "5"})
+	}))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"a       = 1",
+		"longkey = 2",
+		"multi\\",
+		"line key = 3",
+		"",
+		"[s]",
+		"a  = 4",
+		"bb = 5",
+		"",
+	}, "\n"))
+}
+
+func TestRead_EscapedKey(t *testing.T) {
+	got, err := ReadAll(strings.NewReader(strings.Join([]string{
+		`foo\=bar = value`,
+		`\#not a comment = 1`,
+		`\[not a section] = 2`,
+		`back\\slash = 3`,
+		`other\escape = a\=b`,
+		`a\=b = c`,
+		`a\=b\==c=d`,
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "foo=bar", Value: "value"},
+		{Key: "#not a comment", Value: "1"},
+		{Key: "[not a section]", Value: "2"},
+		{Key: `back\slash`, Value: "3"},
+		{Key: `other\escape`, Value: `a\=b`},
+		{Key: "a=b", Value: "c"},
+		{Key: "a=b=", Value: "c=d"},
+	})
+}
+
+func TestWrite_EscapedKey(t *testing.T) {
+	ents := []Entry{
+		{Key: "foo=bar", Value: "1"},
+		{Key: "#hash", Value: "2"},
+		{Key: "[bracket]", Value: "3"},
+		{Key: `back\slash`, Value: "4"},
+		{Key: "mid#[dle", Value: "5"},
+		{Key: "multi\\\nline", Value: "6"},
+	}
+
+	for _, opts := range []WriteOptions{{}, {AlignKeys: true}} {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteWith(&buf, opts, func(emit func(ent Entry)) {
+			for _, ent := range ents {
+				emit(ent)
+			}
+		}))
+
+		got, err := ReadAll(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, ents)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWith(&buf, WriteOptions{AlignKeys: true}, func(emit func(ent Entry)) {
+		emit(Entry{Key: "a=b", Value: "1"})
+		emit(Entry{Key: "abcd", Value: "2"})
+	}))
+	assert.Equal(t, buf.String(), "a\\=b = 1\nabcd = 2\n")
+}
+
+func TestRead_BracketKey(t *testing.T) {
+	got, err := ReadAll(strings.NewReader(strings.Join([]string{
+		`[s]`,
+		`\[k\] = v`,
+		`[weird] = x`,
+		`\[a] = [b]`,
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "s", Key: "[k]", Value: "v"},
+		{Section: "s", Key: "[weird]", Value: "x"},
+		{Section: "s", Key: "[a]", Value: "[b]"},
+	})
+
+	_, err = ReadAll(strings.NewReader(`[a] = [b]`))
+	assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, func(emit func(ent Entry)) {
+		emit(Entry{Key: "[a]", Value: "[b]"})
+	}))
+	assert.Equal(t, buf.String(), "\\[a] = [b]\n")
+}
+
+func TestWrite_HashKey(t *testing.T) {
+	ents := []Entry{
+		{Key: "#channel", Value: "x", Comment: "a real comment"},
+		{Key: "#", Value: "y"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, func(emit func(ent Entry)) {
+		for _, ent := range ents {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), "# a real comment\n\\#channel = x\n\\# = y\n")
+
+	got, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, ents)
+}
+
+func TestWrite_BOMKey(t *testing.T) {
+	data := []byte("\n\ufeffb=2")
+	want, err := ReadAll(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, want, []Entry{{Key: "\ufeffb", Value: "2"}})
+	assert.NoError(t, want[0].Validate())
+
+	out, err := RoundTrip(data)
+	assert.NoError(t, err)
+	assert.Equal(t, string(out), "\"\ufeffb\" = 2\n")
+
+	got, err := ReadAll(bytes.NewReader(out))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, want)
+}
+
+func TestWriteGrouped(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteGrouped(&buf, []Entry{
+		{Section: "b", Key: "x", Value: "1"},
+		{Key: "top", Value: "2"},
+		{Section: "a", Key: "y", Value: "3"},
+		{Section: "b", Key: "z", Value: "4"},
+		{Key: "other", Value: "5"},
+		{Section: "a", Key: "w", Value: "6"},
+	}))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"[b]",
+		"x = 1",
+		"z = 4",
+		"",
+		"[]",
+		"top = 2",
+		"other = 5",
+		"",
+		"[a]",
+		"y = 3",
+		"w = 6",
+		"",
+	}, "\n"))
+}
+
+func TestEscape(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"no newlines", "no newlines"},
+		{"a\nb", "a\\\nb"},
+		{"a\n\nb\n", "a\\\n\\\nb\\\n"},
+		{`back\slash`, `back\slash`},
+	} {
+		assert.Equal(t, Escape(test.in), test.out)
+		assert.Equal(t, Unescape(test.out), test.in)
+	}
+
+	assert.Equal(t, Unescape("a\\\r\nb"), "a\nb")
+}
+
+func TestWriteCount(t *testing.T) {
+	emitAll := func(emit func(ent Entry)) {
+		emit(Entry{Key: "foo", Value: "bar"})
+		emit(Entry{Section: "s", Key: "baz", Value: "bif"})
+	}
+
+	var buf bytes.Buffer
+	n, err := WriteCount(&buf, emitAll)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(buf.Len()))
+	assert.Equal(t, n, int64(len("foo = bar\n\n[s]\nbaz = bif\n")))
+
+	lw := &limitWriter{limit: 12}
+	n, err = WriteCount(lw, emitAll)
+	assert.Equal(t, err, errLimit)
+	assert.Equal(t, n, int64(12))
+	assert.Equal(t, lw.buf.String(), "foo = bar\n\n[")
+}
+
+var errLimit = errors.New("limit reached")
+
+// limitWriter accepts up to limit bytes and then fails.
+type limitWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if room := l.limit - l.buf.Len(); len(p) > room {
+		l.buf.Write(p[:room])
+		return room, errLimit
+	}
+	return l.buf.Write(p)
+}
+
+func TestEntry_Equal(t *testing.T) {
+	ent := Entry{Section: "s", Key: "k", Value: "v", Comment: "c"}
+	assert.That(t, ent.Equal(ent))
+	for _, other := range []Entry{
+		{Key: "k", Value: "v", Comment: "c"},
+		{Section: "s", Value: "v", Comment: "c"},
+		{Section: "s", Key: "k", Comment: "c"},
+		{Section: "s", Key: "k", Value: "v"},
+	} {
+		assert.That(t, !ent.Equal(other))
+	}
+}
+
+func TestEntry_String(t *testing.T) {
+	for _, test := range []struct {
+		ent Entry
+		exp string
+	}{
+		{Entry{Key: "k", Value: "v"}, "k = v"},
+		{Entry{Key: "a=b", Value: " padded ", Comment: "note\nmore"}, "# note\n# more\na\\=b = \" padded \""},
+		{Entry{Key: "multi\nkey", Value: "multi\nvalue"}, "multi\\\nkey = \"multi\\nvalue\""},
+	} {
+		assert.Equal(t, test.ent.String(), test.exp)
+
+		got, err := ReadAll(strings.NewReader(test.exp))
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, []Entry{test.ent})
+	}
+
+	// the entry line with a section is the section declaration and entry
+	// line that Write would write joined by a space.
+	for _, test := range []struct {
+		ent   Entry
+		exp   string
+		write string
+	}{
+		{Entry{Section: "s", Key: "k"}, "[s] k =", "[s]\nk =\n"},
+		{Entry{Section: "a.b", Key: "k", Value: "v"}, "[a.b] k = v", "[a.b]\nk = v\n"},
+		{
+			Entry{Section: "[x]=", Key: "#k", Value: "v", Comment: "note"},
+			"# note\n[\\[x\\]\\=] \\#k = v",
+			"[\\[x\\]\\=]\n# note\n\\#k = v\n",
+		},
+	} {
+		assert.Equal(t, test.ent.String(), test.exp)
+
+		var buf bytes.Buffer
+		assert.NoError(t, Write(&buf, func(emit func(ent Entry)) { emit(test.ent) }))
+		assert.Equal(t, buf.String(), test.write)
+	}
+}
+
+func TestSplitSection(t *testing.T) {
+	for _, test := range []struct {
+		section string
+		parts   []string
+	}{
+		{"", []string{""}},
+		{"a", []string{"a"}},
+		{"a.b.c", []string{"a", "b", "c"}},
+		{`a\.b.c`, []string{"a.b", "c"}},
+		{`a\\.b`, []string{`a\`, "b"}},
+		{`a\\\.b`, []string{`a\.b`}},
+		{`a\b.c`, []string{`a\b`, "c"}},
+		{"a..b.", []string{"a", "", "b", ""}},
+		{".", []string{"", ""}},
+	} {
+		assert.DeepEqual(t, SplitSection(test.section), test.parts)
+		if !strings.Contains(test.section, `\b`) {
+			assert.Equal(t, JoinSection(test.parts...), test.section)
+		}
+	}
+
+	for _, parts := range [][]string{
+		{"a.b", `c\`, "", `\.`},
+		{`\`},
+		{"", ""},
+	} {
+		assert.DeepEqual(t, SplitSection(JoinSection(parts...)), parts)
+	}
+}
+
+func TestEntry_Validate(t *testing.T) {
+	for _, ent := range []Entry{
+		{},
+		{Section: "a.b", Key: "k=#[", Value: " spaced\\ "},
+		{Section: `[a]=\#`, Key: "k"},
+		{Section: "multi\nline", Key: "multi\nline", Value: "multi\nline", Comment: "multi\nline"},
+		{Key: `a\`, Value: `a\`},
+		{Value: "a\\\nb"},
+		{Key: " a"},
+		{Key: "a\n"},
+		{Key: `"a"`},
+	} {
+		assert.NoError(t, ent.Validate())
+	}
+
+	for _, ent := range []Entry{
+		{Comment: "a\\\nb"},
+		{Comment: "a\r"},
+	} {
+		err := ent.Validate()
+		assert.Error(t, err)
+		assert.That(t, errors.Is(err, errs.Tag("invalid entry")))
+	}
+}
+
+func TestAppendEntries(t *testing.T) {
+	existing := "a = 1\n\n[s]\nb = 2\n"
+	ents := []Entry{
+		{Section: "s", Key: "c", Value: "3"},
+		{Section: "t", Key: "d", Value: "4"},
+		{Key: "e", Value: "5"},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(existing)
+	assert.NoError(t, AppendEntries(&buf, "s", ents))
+	assert.Equal(t, buf.String(), existing+"c = 3\n\n[t]\nd = 4\n\n[]\ne = 5\n")
+
+	before, err := ReadAll(strings.NewReader(existing))
+	assert.NoError(t, err)
+	got, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, append(before, ents...))
+
+	buf.Reset()
+	assert.NoError(t, AppendEntries(&buf, "", ents[2:]))
+	assert.Equal(t, buf.String(), "e = 5\n")
+
+	fail := errors.New("fail")
+	assert.Equal(t, AppendEntries(failWriter{err: fail}, "", ents), fail)
+}
+
+func TestWriteWith_Strict(t *testing.T) {
+	emitAll := func(emit func(ent Entry)) {
+		emit(Entry{Key: "a", Value: "1"})
+		emit(Entry{Section: "s", Key: "b", Value: "2", Comment: "b\\"})
+		emit(Entry{Key: "c", Value: "3"})
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWith(&buf, WriteOptions{}, emitAll))
+
+	buf.Reset()
+	err := WriteWith(&buf, WriteOptions{Strict: true}, emitAll)
+	assert.That(t, errors.Is(err, errs.Tag("invalid entry")))
+	assert.Equal(t, buf.String(), "a = 1\n")
+}
+
+func TestWriteWith_LineEnding(t *testing.T) {
+	ents := []Entry{
+		{Key: "a", Value: "1", Comment: "note\nmore"},
+		{Section: "s", Key: "multi\nkey", Value: "line\nvalue"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWith(&buf, WriteOptions{LineEnding: "\r\n"}, func(emit func(ent Entry)) {
+		for _, ent := range ents {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"# note",
+		"# more",
+		"a = 1",
+		"",
+		"[s]",
+		"multi\\",
+		"key = \"line\\nvalue\"",
+		"",
+	}, "\r\n"))
+
+	got, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, ents)
+
+	for _, nl := range []string{"\r", "\n\r", " "} {
+		buf.Reset()
+		err := WriteWith(&buf, WriteOptions{LineEnding: nl}, func(emit func(ent Entry)) {
+			emit(Entry{Key: "a", Value: "1"})
+		})
+		assert.Error(t, err)
+		assert.That(t, strings.Contains(err.Error(), "invalid line ending"))
+		assert.Equal(t, buf.Len(), 0)
+	}
+}
+
+func TestReadWith_MaxLineSize(t *testing.T) {
+	data := "a = b\nfoo = " + strings.Repeat("x", 100)
+
+	err := ReadWith(strings.NewReader(data), ReadOptions{MaxLineSize: 64}, func(ent Entry) error { return nil })
+	assert.Error(t, err)
+	assert.That(t, errors.Is(err, bufio.ErrTooLong))
+	assert.That(t, errors.Is(err, errs.Tag("line too long")))
+	assert.That(t, strings.Contains(err.Error(), "line 2"))
+	assert.That(t, strings.Contains(err.Error(), "MaxLineSize"))
+
+	var got []Entry
+	assert.NoError(t, ReadWith(strings.NewReader(data), ReadOptions{MaxLineSize: 128}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.Equal(t, len(got), 2)
+}
+
+func TestRead_LongLine(t *testing.T) {
+	long := strings.Repeat("x", 200<<10)
+
+	got, err := ReadAll(strings.NewReader("foo = " + long + "\nbar = baz"))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "foo", Value: long},
+		{Key: "bar", Value: "baz"},
+	})
+
+	got, err = ReadAll(strings.NewReader("foo = " + long + "\\\n" + long))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "foo", Value: long + "\n" + long},
+	})
+}
+
+func TestReadWith_PreserveValueSpace(t *testing.T) {
+	data := strings.Join([]string{
+		"a = value  ",
+		"b=\ttabbed",
+		`c = "quoted"`,
+		"d = multi \\",
+		"  line ",
+		"e = note  # here",
+		"f =",
+	}, "\n")
+
+	read := func(opts ReadOptions) (values []string) {
+		assert.NoError(t, ReadWith(strings.NewReader(data), opts, func(ent Entry) error {
+			values = append(values, ent.Value)
+			return nil
+		}))
+		return values
+	}
+
+	assert.DeepEqual(t, read(ReadOptions{}), []string{
+		"value", "tabbed", "quoted", "multi \n  line", "note  # here", "",
+	})
+	assert.DeepEqual(t, read(ReadOptions{PreserveValueSpace: true}), []string{
+		" value  ", "\ttabbed", ` "quoted"`, " multi \n  line ", " note  # here", "",
+	})
+	assert.DeepEqual(t, read(ReadOptions{PreserveValueSpace: true, InlineComments: true}), []string{
+		" value  ", "\ttabbed", ` "quoted"`, " multi \n  line ", " note ", "",
+	})
+}
+
+func TestDefaultSection(t *testing.T) {
+	data := "top = 1\n\n[a]\nx = 2\n\n[]\nbottom = 3\n"
+
+	var got []Entry
+	assert.NoError(t, ReadWith(strings.NewReader(data), ReadOptions{DefaultSection: "DEFAULT"}, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "DEFAULT", Key: "top", Value: "1"},
+		{Section: "a", Key: "x", Value: "2"},
+		{Section: "DEFAULT", Key: "bottom", Value: "3"},
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWith(&buf, WriteOptions{DefaultSection: "DEFAULT"}, func(emit func(ent Entry)) {
+		for _, ent := range got {
+			emit(ent)
+		}
+	}))
+	assert.Equal(t, buf.String(), data)
+
+	buf.Reset()
+	assert.NoError(t, WriteWith(&buf, WriteOptions{}, func(emit func(ent Entry)) {
+		emit(got[0])
+	}))
+	assert.Equal(t, buf.String(), "[DEFAULT]\ntop = 1\n")
+}
+
+func TestReadWith_SectionFromKeyDot(t *testing.T) {
+	data := "db.host = localhost\ndb.pool.size = 4\nplain = 1\n[s]\na.b = 2\n[]\nc.d = 3"
+
+	read := func(opts ReadOptions) (ents []Entry) {
+		assert.NoError(t, ReadWith(strings.NewReader(data), opts, func(ent Entry) error {
+			ents = append(ents, ent)
+			return nil
+		}))
+		return ents
+	}
+
+	assert.DeepEqual(t, read(ReadOptions{SectionFromKeyDot: true}), []Entry{
+		{Section: "db", Key: "host", Value: "localhost"},
+		{Section: "db", Key: "pool.size", Value: "4"},
+		{Key: "plain", Value: "1"},
+		{Section: "s", Key: "a.b", Value: "2"},
+		{Section: "c", Key: "d", Value: "3"},
+	})
+	assert.Equal(t, read(ReadOptions{})[0].Key, "db.host")
+}
+
+func TestReadWith_RejectEmptyKey(t *testing.T) {
+	data := "a = 1\n= value"
+
+	got, err := ReadAll(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{{Key: "a", Value: "1"}, {Value: "value"}})
+
+	err = ReadWith(strings.NewReader(data), ReadOptions{RejectEmptyKey: true}, func(ent Entry) error { return nil })
+	assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+	assert.Equal(t, err.Error(), `invalid line: line 2: empty key: "= value"`)
+
+	for data, line := range map[string]int{"=": 1, "  =  ": 1, "\n\n \t= x": 3, "a = 1\\\n\n=": 3} {
+		got, err := ReadAll(strings.NewReader(data))
+		assert.NoError(t, err)
+		assert.Equal(t, got[len(got)-1].Key, "")
+
+		err = ReadWith(strings.NewReader(data), ReadOptions{RejectEmptyKey: true}, func(ent Entry) error { return nil })
+		var perr *ParseError
+		assert.That(t, errors.As(err, &perr))
+		assert.Equal(t, perr.Line, line)
+	}
+
+	err = ReadWith(strings.NewReader(`\= = x`), ReadOptions{RejectEmptyKey: true}, func(ent Entry) error { return nil })
+	assert.NoError(t, err)
+}
+
+func TestReadWith_RequireSpacedSeparator(t *testing.T) {
+	opts := ReadOptions{RequireSpacedSeparator: true}
+	for _, data := range []string{"a = 1", "a\t=\t1", "= 1", "a =", "[s]\na = b=c"} {
+		err := ReadWith(strings.NewReader(data), opts, func(ent Entry) error { return nil })
+		assert.NoError(t, err)
+	}
+
+	for _, data := range []string{"a=1", "a =1", "a= 1"} {
+		err := ReadWith(strings.NewReader(data), ReadOptions{}, func(ent Entry) error { return nil })
+		assert.NoError(t, err)
+
+		err = ReadWith(strings.NewReader(data), opts, func(ent Entry) error { return nil })
+		assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+	}
+
+	err := ReadWith(strings.NewReader("a = 1\nb=2"), opts, func(ent Entry) error { return nil })
+	assert.Equal(t, err.Error(), `invalid line: line 2: separator not surrounded by spaces: "b=2"`)
+}
+
+func TestReadWith_Strict(t *testing.T) {
+	for data, want := range map[string]string{
+		"a = 1\\":              `invalid line: line 1: continued line at end of input: "a = 1\n"`,
+		"a = 1\nb = \\\n2\\\n": `invalid line: line 2: continued line at end of input: "b = \n2\n"`,
+		"a = 1\n  \\\n\nb = 2": `invalid line: line 2: continued blank line: "  \n"`,
+		"# a\\\nb = 2":         `invalid line: line 1: continued comment: "# a\nb = 2"`,
+	} {
+		_, err := ReadAll(strings.NewReader(data))
+		assert.NoError(t, err)
+
+		err = ReadWith(strings.NewReader(data), ReadOptions{Strict: true}, func(ent Entry) error { return nil })
+		assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+		assert.Equal(t, err.Error(), want)
+	}
+
+	got, err := ReadAll(strings.NewReader("a = multi\\\nline\n\n# comment\nb = 2\n"))
+	assert.NoError(t, err)
+	var strict []Entry
+	err = ReadWith(strings.NewReader("a = multi\\\nline\n\n# comment\nb = 2\n"), ReadOptions{Strict: true}, func(ent Entry) error {
+		strict = append(strict, ent)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, strict, got)
+}
+
+func TestReadWith_DuplicateKeys(t *testing.T) {
+	data := "[a]\nfoo = 1\n[b]\nfoo = 2\n[a]\nbar = 3\nfoo = 4"
+
+	got, err := ReadAll(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, len(got), 4)
+
+	var ents []Entry
+	err = ReadWith(strings.NewReader(data), ReadOptions{DuplicateKeys: DuplicateError}, func(ent Entry) error {
+		ents = append(ents, ent)
+		return nil
+	})
+	assert.Error(t, err)
+	assert.That(t, errors.Is(err, errs.Tag("duplicate key")))
+	assert.That(t, strings.Contains(err.Error(), `line 7: section "a" key "foo"`))
+	assert.DeepEqual(t, ents, got[:3])
+
+	ents = ents[:0]
+	err = ReadWith(strings.NewReader(data), ReadOptions{DuplicateKeys: DuplicateFirstWins}, func(ent Entry) error {
+		ents = append(ents, ent)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, ents, got[:3])
+}
+
+func TestReadAll(t *testing.T) {
+	for _, test := range tests {
+		got, err := ReadAll(test.Reader())
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, test.Entries)
+	}
+
+	got, err := ReadAll(strings.NewReader("foo = bar\nfoo = baz\ninvalid\nbar = baz"))
+	assert.Error(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Key: "foo", Value: "bar"},
+		{Key: "foo", Value: "baz"},
+	})
+}
+
+func TestReadSection(t *testing.T) {
+	data := "top = 1\n[a]\nx = 1\n[b]\ny = 2\n[a]\nz = 3"
+
+	var got []Entry
+	assert.NoError(t, ReadSection(strings.NewReader(data), "a", func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "a", Key: "x", Value: "1"},
+		{Section: "a", Key: "z", Value: "3"},
+	})
+
+	got = got[:0]
+	assert.NoError(t, ReadSection(strings.NewReader(data), "", func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []Entry{{Key: "top", Value: "1"}})
+
+	err := ReadSection(strings.NewReader(data), "b", func(ent Entry) error { return io.ErrUnexpectedEOF })
+	assert.Equal(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReadPos(t *testing.T) {
+	data := "\xEF\xBB\xBFa = 1\r\n\r\n# comment\r\n  b = multi\\\r\nline\n[s]\nc = 3"
+
+	type result struct {
+		Key string
+		Pos Pos
+	}
+	exp := []result{
+		{"a", Pos{Line: 1, Offset: 3}},
+		{"b", Pos{Line: 4, Offset: 23}},
+		{"c", Pos{Line: 7, Offset: 46}},
+	}
+
+	var got []result
+	assert.NoError(t, ReadPos(strings.NewReader(data), func(ent Entry, pos Pos) error {
+		got = append(got, result{ent.Key, pos})
+		return nil
+	}))
+	assert.DeepEqual(t, got, exp)
+
+	got = got[:0]
+	dec := newLinesDecoder(&byteLines{data: []byte(data)}, ReadOptions{})
+	for {
+		ent, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		got = append(got, result{ent.Key, dec.Pos()})
+	}
+	assert.DeepEqual(t, got, exp)
+}
+
+func TestValidate(t *testing.T) {
+	got := Validate(strings.NewReader(strings.Join([]string{
+		"a = b",
+		"bad",
+		"# comment",
+		"[ok]",
+		"c = d",
+		"[bad=section]",
+		"multi\\",
+		"line",
+		"e = f",
+	}, "\n")))
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[0].Error(), `invalid line: line 2: "bad"`)
+	assert.Equal(t, got[1].Error(), `invalid line: line 6: section name contains '=': "[bad=section]"`)
+	assert.Equal(t, got[2].Error(), `invalid line: line 7: "multi\nline"`)
+
+	assert.Equal(t, len(Validate(strings.NewReader("a = b"))), 0)
+
+	fail := errors.New("fail")
+	got = Validate(io.MultiReader(strings.NewReader("bad\n"), failReader{err: fail}))
+	assert.Equal(t, len(got), 2)
+	assert.That(t, errors.Is(got[1], fail))
+}
+
+func TestRead_ErrStop(t *testing.T) {
+	data := "a = 1\nb = 2\nc = 3\ninvalid\n"
+
+	var got []string
+	err := Read(strings.NewReader(data), func(ent Entry) error {
+		got = append(got, ent.Key)
+		if ent.Key == "b" {
+			return ErrStop
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []string{"a", "b"})
+
+	got = nil
+	err = ReadRaw(strings.NewReader(data), func(line RawLine) error {
+		got = append(got, line.Key)
+		return fmt.Errorf("wrapped: %w", ErrStop)
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []string{"a"})
+
+	got = nil
+	err = ReadParallel(strings.NewReader(data), int64(len(data)), 2, func(ent Entry) error {
+		got = append(got, ent.Key)
+		return ErrStop
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []string{"a"})
+}
+
+func TestReadContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []Entry
+	err := ReadContext(ctx, strings.NewReader("a = 1\nb = 2\nc = 3"), func(ent Entry) error {
+		got = append(got, ent)
+		if len(got) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, len(got), 2)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	err = ReadContext(ctx, blockReader(block), func(ent Entry) error { return nil })
+	assert.Equal(t, err, context.Canceled)
+}
+
+func TestReadContext_Unconsumed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := strings.NewReader("a = 1\nb = 2")
+	err := ReadContext(ctx, r, func(ent Entry) error { return nil })
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, r.Len(), int(r.Size()))
+}
+
+type blockReader chan struct{}
+
+func (b blockReader) Read(p []byte) (int, error) {
+	<-b
+	return 0, io.EOF
+}
+
+func TestRead_CallbackError(t *testing.T) {
+	err := ReadString("foo = bar", func(ent Entry) error { return io.ErrUnexpectedEOF })
+	assert.Equal(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRead_ReaderError(t *testing.T) {
+	fail := errors.New("fail")
+	r := io.MultiReader(strings.NewReader("a = b\n"), failReader{err: fail})
+
+	var got []Entry
+	err := Read(r, func(ent Entry) error {
+		got = append(got, ent)
+		return nil
+	})
+	assert.Error(t, err)
+	assert.That(t, errors.Is(err, fail))
+	assert.That(t, errors.Is(err, errs.Tag("read")))
+	assert.Equal(t, err.Error(), "read: fail")
+	assert.DeepEqual(t, got, []Entry{{Key: "a", Value: "b"}})
+}
+
+type failReader struct{ err error }
+
+func (f failReader) Read(p []byte) (int, error) { return 0, f.err }
+
+func TestRead_InvalidLine(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		err  string
+	}{
+		{"foo", `invalid line: line 1: "foo"`},
+		{"a = b\n\n# c\nfoo", `invalid line: line 4: "foo"`},
+		{"a = b\nfoo\\\nbar\\\nbaz", `invalid line: line 2: "foo\nbar\nbaz"`},
+		{"a = b\\\nc\nfoo", `invalid line: line 3: "foo"`},
+		{"  \n\t\nfoo", `invalid line: line 3: "foo"`},
+	} {
+		err := ReadString(test.data, func(ent Entry) error { return nil })
+		assert.Error(t, err)
+		assert.Equal(t, err.Error(), test.err)
+	}
+}
+
+func TestRead_InvalidSection(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		err  string
+	}{
+		{"[a[b]", `invalid line: line 1: section name contains '[': "[a[b]"`},
+		{"[a]b]", `invalid line: line 1: section name contains ']': "[a]b]"`},
+		{"[a\\b]", `invalid line: line 1: section name contains '\\': "[a\\b]"`},
+		{"a = b\n[bad=name]", `invalid line: line 2: section name contains '=': "[bad=name]"`},
+		{"[a#b]", `invalid line: line 1: section name contains '#': "[a#b]"`},
+	} {
+		err := ReadString(test.data, func(ent Entry) error { return nil })
+		assert.Error(t, err)
+		assert.Equal(t, err.Error(), test.err)
+
+		var perr *ParseError
+		assert.That(t, errors.As(err, &perr))
+		assert.That(t, perr.Reason != "")
+	}
+
+	got, err := ReadAll(strings.NewReader("[a\\\nb]\nc = d"))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{{Section: "a\nb", Key: "c", Value: "d"}})
+
+	_, err = ReadAll(strings.NewReader("[a=b]\nc : d"))
+	assert.Error(t, err)
+
+	var ents []Entry
+	err = ReadWith(strings.NewReader("[a=b]\nc : d"), ReadOptions{Separator: ':'}, func(ent Entry) error {
+		ents = append(ents, ent)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.DeepEqual(t, ents, []Entry{{Section: "a=b", Key: "c", Value: "d"}})
+}
+
+func TestRead_EscapedSection(t *testing.T) {
+	got, err := ReadAll(strings.NewReader(strings.Join([]string{
+		`[a\]b]`,
+		`k = 1`,
+		`[\[\]\\\=\#]`,
+		`k = 2`,
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, []Entry{
+		{Section: "a]b", Key: "k", Value: "1"},
+		{Section: `[]\=#`, Key: "k", Value: "2"},
+	})
+
+	for _, data := range []string{`[a\]`, `[a\b]`, `[a\]]]`, `[a\[=]`} {
+		_, err := ReadAll(strings.NewReader(data))
+		assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+	}
+
+	ents := []Entry{
+		{Section: "a]b", Key: "k", Value: "1"},
+		{Section: `[]\=#:`, Key: "k", Value: "2"},
+		{Section: "multi\\\nline", Key: "k", Value: "3"},
+	}
+	for _, sep := range []byte{'=', ':'} {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteWith(&buf, WriteOptions{Separator: sep}, func(emit func(ent Entry)) {
+			for _, ent := range ents {
+				emit(ent)
+			}
+		}))
+
+		var got []Entry
+		assert.NoError(t, ReadWith(&buf, ReadOptions{Separator: sep}, func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		}))
+		assert.DeepEqual(t, got, ents)
+	}
+}
+
+func TestRead_ParseError(t *testing.T) {
+	err := ReadString("a = b\nfoo\\\nbar", func(ent Entry) error { return nil })
+
+	var perr *ParseError
+	assert.That(t, errors.As(err, &perr))
+	assert.Equal(t, perr.Line, 2)
+	assert.Equal(t, perr.Content, "foo\nbar")
+	assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+}
+
 func TestWrite_RoundTrip(t *testing.T) {
 	for _, test := range tests {
 		var got []Entry
@@ -30,7 +1285,7 @@ func TestWrite_RoundTrip(t *testing.T) {
 				emit(ent)
 			}
 		}))
-		assert.Equal(t, test.NormalizedData(), strings.TrimSpace(buf.String()))
+		assert.Equal(t, strings.TrimSpace(buf.String()), test.NormalizedData())
 
 		assert.NoError(t, Read(&buf, func(ent Entry) error {
 			got = append(got, ent)
@@ -40,6 +1295,62 @@ func TestWrite_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestNormalize(t *testing.T) {
+	for _, test := range tests {
+		got, err := Normalize([]byte(test.String()))
+		assert.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(string(got)), test.NormalizedData())
+
+		again, err := Normalize(got)
+		assert.NoError(t, err)
+		assert.Equal(t, string(again), string(got))
+
+		ents, err := ReadAll(bytes.NewReader(got))
+		assert.NoError(t, err)
+		assert.DeepEqual(t, ents, test.Entries)
+	}
+
+	a, err := Normalize([]byte("  a=1\n[s]\nb =  \"2\"\n[s]\nc=3"))
+	assert.NoError(t, err)
+	b, err := Normalize([]byte("a = 1\n\n\n[s]\nb = 2\nc = 3\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(a), string(b))
+
+	_, err = Normalize([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+func benchmarkData() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&buf, "[section%d]\n# comment\n", i)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&buf, "key%d = some value for the key\n", j)
+		}
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkRead(b *testing.B) {
+	data := benchmarkData()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = Read(bytes.NewReader(data), func(ent Entry) error { return nil })
+	}
+}
+
+func BenchmarkReadBytes(b *testing.B) {
+	data := benchmarkData()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = ReadBytes(data, func(ent Entry) error { return nil })
+	}
+}
+
 //
 // test cases
 //
@@ -50,27 +1361,66 @@ type testCase struct {
 }
 
 func (t testCase) NormalizedData() string {
-	data := strings.Split(t.Data, "\n")
-	inMultilineComment := false
-	for i, v := range data {
+	// comments are written one per line with a single space after the '#',
+	// comments before a section are dropped, values continued onto more
+	// lines are quoted with their newlines and tabs escaped, and the only
+	// empty lines are the ones separating sections.
+	var out []string
+	var pending, value []string
+	inMultilineComment, inMultilineValue := false, false
+	for _, v := range strings.Split(t.Data, "\n") {
 		v = strings.TrimPrefix(v, "\t\t")
-		if (len(v) > 0 && v[0] == '#') || inMultilineComment {
-			inMultilineComment = v[len(v)-1] == '\\'
-			v = ""
+		if inMultilineComment || (len(v) > 0 && v[0] == '#') {
+			if !inMultilineComment {
+				v = strings.TrimPrefix(strings.TrimPrefix(v, "#"), " ")
+			}
+			inMultilineComment = strings.HasSuffix(v, "\\")
+			v = strings.TrimSuffix(v, "\\")
+			if len(v) > 0 {
+				v = " " + v
+			}
+			pending = append(pending, "#"+v)
+			continue
+		}
+		if len(strings.TrimSpace(v)) == 0 {
+			continue
 		}
-		data[i] = v
+		if inMultilineValue || (v[0] != '[' && strings.HasSuffix(v, "\\")) {
+			inMultilineValue = strings.HasSuffix(v, "\\")
+			value = append(value, strings.TrimSuffix(v, "\\"))
+			if inMultilineValue {
+				continue
+			}
+			v = strings.Replace(strings.Join(value, `\n`), "\t", `\t`, -1)
+			idx := strings.Index(v, " = ") + len(" = ")
+			v = v[:idx] + `"` + v[idx:] + `"`
+			value = nil
+		}
+		if v[0] == '[' {
+			if len(out) > 0 {
+				out = append(out, "")
+			}
+			pending = nil
+		}
+		out = append(out, pending...)
+		out = append(out, v)
+		pending = nil
 	}
-	return strings.TrimSpace(strings.Join(data, "\n"))
+	return strings.Join(out, "\n")
 }
 
-func (t testCase) Reader() io.Reader {
+func (t testCase) String() string {
 	// the data has every line prefixed with \t\t to make the
 	// test definitions easier to read so we trim them off here
 	data := strings.Split(t.Data, "\n")
 	for i, v := range data {
 		data[i] = strings.TrimPrefix(v, "\t\t")
 	}
-	return strings.NewReader(strings.Join(data, "\n"))
+	return strings.Join(data, "\n")
+}
+
+func (t testCase) Reader() io.Reader {
+	return strings.NewReader(t.String())
 }
 
 var tests = []testCase{
@@ -97,7 +1447,7 @@ var tests = []testCase{
 		# a comment
 		foo = bar
 	`, []Entry{
-		{Key: "foo", Value: "bar"},
+		{Key: "foo", Value: "bar", Comment: "a comment"},
 	}},
 
 	{`
@@ -105,7 +1455,7 @@ var tests = []testCase{
 		comment
 		foo = bar
 	`, []Entry{
-		{Key: "foo", Value: "bar"},
+		{Key: "foo", Value: "bar", Comment: "multi line \ncomment"},
 	}},
 
 	{`
@@ -135,7 +1485,43 @@ var tests = []testCase{
 		# comments
 		foo = bar
 	`, []Entry{
-		{Key: "foo", Value: "bar"},
+		{Key: "foo", Value: "bar", Comment: "multiple\ncomments"},
+	}},
+
+	{`
+		# first
+		foo = bar
+		# second
+		baz = bif
+	`, []Entry{
+		{Key: "foo", Value: "bar", Comment: "first"},
+		{Key: "baz", Value: "bif", Comment: "second"},
+	}},
+
+	{`
+		[table]
+		# multi line \
+		comment
+		foo = bar
+	`, []Entry{
+		{Section: "table", Key: "foo", Value: "bar", Comment: "multi line \ncomment"},
+	}},
+
+	{`
+		# only the first
+		foo = bar
+		baz = bif
+	`, []Entry{
+		{Key: "foo", Value: "bar", Comment: "only the first"},
+		{Key: "baz", Value: "bif"},
+	}},
+
+	{`
+		#no space
+		#  extra space
+		foo = bar
+	`, []Entry{
+		{Key: "foo", Value: "bar", Comment: "no space\n extra space"},
 	}},
 
 	{`
@@ -144,7 +1530,27 @@ var tests = []testCase{
 		foo = bar
 
 	`, []Entry{
-		{Key: "foo", Value: "bar"},
+		{Key: "foo", Value: "bar", Comment: "empty lines are ignored"},
+	}},
+
+	{`
+		# dropped by the section
+		[table]
+		foo = bar
+	`, []Entry{
+		{Section: "table", Key: "foo", Value: "bar"},
+	}},
+
+	{`
+		foo = "  padded  "
+		bar = "\"quoted\""
+		baz = "multi\nline "
+		bif = " a\tb\\c "
+	`, []Entry{
+		{Key: "foo", Value: "  padded  "},
+		{Key: "bar", Value: `"quoted"`},
+		{Key: "baz", Value: "multi\nline "},
+		{Key: "bif", Value: " a\tb\\c "},
 	}},
 
 	{`
@@ -0,0 +1,259 @@
+package ini
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// field describes where a struct field is stored in an INI document.
+type field struct {
+	section   string
+	key       string
+	index     []int
+	omitEmpty bool
+	remaining bool
+}
+
+// remainingType is the type of a field tagged with ",remaining".
+var remainingType = reflect.TypeOf(map[string]map[string]string(nil))
+
+// structFields returns the fields of the struct type t. Untagged fields use
+// their lowercased name as the key. Nested structs become sections named by
+// their tag or lowercased name, joined with '.' when nested more than once.
+func structFields(t reflect.Type, section string, index []int) (fields []field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name, opts := sf.Tag.Get("ini"), ""
+		if idx := strings.IndexByte(name, ','); idx >= 0 {
+			name, opts = name[:idx], name[idx:]
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+
+		fi := append(append([]int(nil), index...), i)
+
+		if strings.Contains(opts, ",remaining") {
+			fields = append(fields, field{index: fi, remaining: true})
+			continue
+		}
+
+		if sf.Type.Kind() == reflect.Struct {
+			sub := name
+			if section != "" {
+				sub = section + "." + name
+			}
+			fields = append(fields, structFields(sf.Type, sub, fi)...)
+			continue
+		}
+
+		f := field{
+			section:   section,
+			key:       name,
+			index:     fi,
+			omitEmpty: strings.Contains(opts, ",omitempty"),
+		}
+		if section == "" {
+			if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+				f.section, f.key = name[:idx], name[idx+1:]
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// Marshal returns the INI encoding of the struct v using the same struct
+// tags as Unmarshal. Fields are grouped by section, with top-level fields
+// first, and zero values are written unless the field is tagged with
+// ",omitempty". Strings, bools, and integer and float types are supported
+// and any other field type, such as a slice, causes an error. The entries of
+// a field tagged with ",remaining" are added after the other fields with
+// their sections and keys sorted.
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errs.Errorf("marshal requires a struct: %T", v)
+	}
+
+	sections := []string{""}
+	grouped := make(map[string][]Entry)
+	add := func(ent Entry) {
+		if _, ok := grouped[ent.Section]; !ok && ent.Section != "" {
+			sections = append(sections, ent.Section)
+		}
+		grouped[ent.Section] = append(grouped[ent.Section], ent)
+	}
+
+	var remaining map[string]map[string]string
+	for _, f := range structFields(rv.Type(), "", nil) {
+		fv := rv.FieldByIndex(f.index)
+		if f.remaining {
+			if !fv.Type().ConvertibleTo(remainingType) {
+				return nil, errs.Errorf("remaining field must be a %v: %v", remainingType, fv.Type())
+			}
+			remaining = fv.Convert(remainingType).Interface().(map[string]map[string]string)
+			continue
+		}
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		value, err := formatValue(fv)
+		if err != nil {
+			return nil, errs.Errorf("section %q key %q: %w", f.section, f.key, err)
+		}
+		add(Entry{Section: f.section, Key: f.key, Value: value})
+	}
+
+	for _, section := range sortedKeys(remaining) {
+		for _, key := range sortedKeys(remaining[section]) {
+			add(Entry{Section: section, Key: key, Value: remaining[section][key]})
+		}
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, func(emit func(ent Entry)) {
+		for _, section := range sections {
+			for _, ent := range grouped[section] {
+				emit(ent)
+			}
+		}
+	})
+	return buf.Bytes(), err
+}
+
+// Unmarshal parses the INI data and stores the values into the struct
+// pointed to by v. Fields are matched using `ini:"section.key"` struct tags
+// and entries that do not match any field are ignored, unless the struct has
+// a field tagged with `ini:",remaining"` of type map[string]map[string]string,
+// in which case they are stored in it by section and key.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errs.Errorf("unmarshal requires a non-nil pointer to a struct: %T", v)
+	}
+	rv = rv.Elem()
+
+	var remaining reflect.Value
+	lookup := make(map[[2]string]field)
+	for _, f := range structFields(rv.Type(), "", nil) {
+		if f.remaining {
+			remaining = rv.FieldByIndex(f.index)
+			if !remainingType.ConvertibleTo(remaining.Type()) {
+				return errs.Errorf("remaining field must be a %v: %v", remainingType, remaining.Type())
+			}
+			continue
+		}
+		lookup[[2]string{f.section, f.key}] = f
+	}
+
+	return ReadBytes(data, func(ent Entry) error {
+		f, ok := lookup[[2]string{ent.Section, ent.Key}]
+		if !ok {
+			if remaining.IsValid() {
+				if remaining.IsNil() {
+					remaining.Set(reflect.MakeMap(remaining.Type()))
+				}
+				m := remaining.Convert(remainingType).Interface().(map[string]map[string]string)
+				if m[ent.Section] == nil {
+					m[ent.Section] = make(map[string]string)
+				}
+				m[ent.Section][ent.Key] = ent.Value
+			}
+			return nil
+		}
+		if err := setValue(rv.FieldByIndex(f.index), ent.Value); err != nil {
+			return errs.Errorf("section %q key %q: %w", ent.Section, ent.Key, err)
+		}
+		return nil
+	})
+}
+
+// setValue parses value into rv based on its kind.
+func setValue(rv reflect.Value, value string) error {
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := strconv.ParseInt(value, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(x)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := strconv.ParseUint(value, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(x)
+
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(value, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(x)
+
+	case reflect.Bool:
+		x, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(x)
+
+	default:
+		return errs.Errorf("unsupported type: %v", rv.Type())
+	}
+	return nil
+}
+
+// formatValue formats rv based on its kind.
+func formatValue(rv reflect.Value) (string, error) {
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits()), nil
+
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+
+	default:
+		return "", errs.Errorf("unsupported type: %v", rv.Type())
+	}
+}
+
+// sortedKeys returns the keys of the map m in sorted order.
+func sortedKeys(m interface{}) []string {
+	rv := reflect.ValueOf(m)
+	keys := make([]string, 0, rv.Len())
+	for _, key := range rv.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
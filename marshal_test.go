@@ -0,0 +1,173 @@
+package ini
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+type marshalConfig struct {
+	Name    string
+	Debug   bool   `ini:"debug"`
+	Version uint16 `ini:"meta.version"`
+	Ignored string `ini:"-"`
+
+	Server struct {
+		Host    string  `ini:"host"`
+		Port    int     `ini:"port"`
+		Timeout float64 `ini:"timeout"`
+
+		TLS struct {
+			Enabled bool `ini:"enabled"`
+		} `ini:"tls"`
+	} `ini:"server"`
+
+	Limits struct {
+		Max int8
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var cfg marshalConfig
+	assert.NoError(t, Unmarshal([]byte(strings.Join([]string{
+		"name = example",
+		"debug = true",
+		"ignored = nope",
+		"unknown = skipped",
+		"[meta]",
+		"version = 3",
+		"[server]",
+		"host = localhost",
+		"port = -8080",
+		"timeout = 2.5",
+		"[server.tls]",
+		"enabled = true",
+		"[limits]",
+		"max = 127",
+	}, "\n")), &cfg))
+
+	assert.Equal(t, cfg.Name, "example")
+	assert.Equal(t, cfg.Debug, true)
+	assert.Equal(t, cfg.Version, uint16(3))
+	assert.Equal(t, cfg.Ignored, "")
+	assert.Equal(t, cfg.Server.Host, "localhost")
+	assert.Equal(t, cfg.Server.Port, -8080)
+	assert.Equal(t, cfg.Server.Timeout, 2.5)
+	assert.Equal(t, cfg.Server.TLS.Enabled, true)
+	assert.Equal(t, cfg.Limits.Max, int8(127))
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	var cfg marshalConfig
+
+	err := Unmarshal([]byte("[server]\nport = http"), &cfg)
+	assert.Error(t, err)
+	assert.That(t, strings.Contains(err.Error(), `section "server" key "port"`))
+
+	err = Unmarshal([]byte("[limits]\nmax = 128"), &cfg)
+	assert.Error(t, err)
+	assert.That(t, strings.Contains(err.Error(), `section "limits" key "max"`))
+
+	assert.Error(t, Unmarshal(nil, cfg))
+	assert.Error(t, Unmarshal(nil, (*marshalConfig)(nil)))
+}
+
+func TestMarshal(t *testing.T) {
+	var cfg marshalConfig
+	cfg.Name = "example"
+	cfg.Version = 3
+	cfg.Ignored = "ignored"
+	cfg.Server.Host = "localhost"
+	cfg.Server.Port = 8080
+	cfg.Server.Timeout = 0.1
+	cfg.Limits.Max = -1
+
+	data, err := Marshal(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), strings.Join([]string{
+		"name = example",
+		"debug = false",
+		"",
+		"[meta]",
+		"version = 3",
+		"",
+		"[server]",
+		"host = localhost",
+		"port = 8080",
+		"timeout = 0.1",
+		"",
+		"[server.tls]",
+		"enabled = false",
+		"",
+		"[limits]",
+		"max = -1",
+		"",
+	}, "\n"))
+
+	var got marshalConfig
+	assert.NoError(t, Unmarshal(data, &got))
+	cfg.Ignored = ""
+	assert.Equal(t, got, cfg)
+}
+
+func TestMarshal_OmitEmpty(t *testing.T) {
+	type config struct {
+		A string  `ini:"a,omitempty"`
+		B int     `ini:"s.b,omitempty"`
+		C float32 `ini:"s.c,omitempty"`
+		D bool    `ini:"s.d"`
+	}
+
+	data, err := Marshal(config{C: 1.5})
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), "[s]\nc = 1.5\nd = false\n")
+
+	var got config
+	assert.NoError(t, Unmarshal(data, &got))
+	assert.Equal(t, got, config{C: 1.5})
+}
+
+func TestMarshal_Unsupported(t *testing.T) {
+	_, err := Marshal(struct {
+		Hosts []string `ini:"server.hosts"`
+	}{})
+	assert.Error(t, err)
+	assert.That(t, strings.Contains(err.Error(), `section "server" key "hosts"`))
+	assert.That(t, strings.Contains(err.Error(), "[]string"))
+
+	_, err = Marshal(struct {
+		Hosts []string `ini:"-"`
+		Name  string   `ini:"name"`
+	}{Name: "x"})
+	assert.NoError(t, err)
+
+	_, err = Marshal("not a struct")
+	assert.Error(t, err)
+}
+
+func TestUnmarshal_Remaining(t *testing.T) {
+	type config struct {
+		Name  string                       `ini:"name"`
+		Other map[string]map[string]string `ini:",remaining"`
+	}
+
+	data := []byte("name = x\nextra = 1\n\n[s]\nkey = 2\n")
+
+	var cfg config
+	assert.NoError(t, Unmarshal(data, &cfg))
+	assert.Equal(t, cfg.Name, "x")
+	assert.DeepEqual(t, cfg.Other, map[string]map[string]string{
+		"":  {"extra": "1"},
+		"s": {"key": "2"},
+	})
+
+	got, err := Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, string(got), string(data))
+
+	var bad struct {
+		Other map[string]string `ini:",remaining"`
+	}
+	assert.Error(t, Unmarshal(data, &bad))
+}
@@ -0,0 +1,212 @@
+package ini
+
+import "io"
+
+// DefaultMaxLineSize is the maximum length in bytes of a single line of
+// input when ReadOptions.MaxLineSize is zero.
+const DefaultMaxLineSize = 1 << 20
+
+// ReadOptions controls the behavior of ReadWith. The zero value of every
+// field keeps the behavior described by the package specification, so the
+// zero ReadOptions matches Read and new fields may be added without changing
+// the behavior of existing callers. Behavior that is on by default, like
+// allowing empty keys or trimming keys and values, is disabled by a field
+// named for its opposite, like RejectEmptyKey.
+type ReadOptions struct {
+	// CommentPrefixes are the bytes that begin a comment line when they are
+	// the first non-space byte. If empty, only '#' begins a comment. They
+	// may not appear in section names.
+	CommentPrefixes []byte
+
+	// Separator is the byte that separates a key from its value. If zero,
+	// '=' is used. It may not appear in section names.
+	Separator byte
+
+	// InlineComments causes whitespace followed by a comment prefix to end
+	// the value. The rest of the line is added as the last line of the
+	// entry's comment, so writing the entry moves it above the entry. A
+	// comment prefix may be escaped with '\\' to include it in the value.
+	//
+	// This makes values ambiguous: "a = b # c" is the value "b # c" without
+	// it but "b" with it, and reading such a value back requires the same
+	// setting it was written for. Values containing a comment prefix after
+	// whitespace must be quoted or escaped to survive it.
+	InlineComments bool
+
+	// MaxLineSize is the maximum length in bytes of a single line of input,
+	// not counting continuation lines. If zero, DefaultMaxLineSize is used.
+	MaxLineSize int
+
+	// DefaultSection is the section of entries before any section
+	// declaration and after a declaration of the empty section "[]".
+	DefaultSection string
+
+	// SectionFromKeyDot causes the keys of entries in the default section
+	// that contain a '.' to be split on the first one into a section and a
+	// key, so that "db.host = x" is the key "host" in the section "db".
+	SectionFromKeyDot bool
+
+	// PreserveValueSpace causes values to be everything after the separator
+	// to the end of the logical line, instead of being space trimmed and
+	// unquoted as they are by default. Continuation lines are joined with
+	// '\n' as usual and keep their leading indentation, and any space before
+	// an inline comment is kept. Values written by Write will have a leading
+	// space.
+	PreserveValueSpace bool
+
+	// Strict causes an error for lines that are otherwise accepted but are
+	// likely mistakes: a comment or blank line continued with a trailing
+	// '\', which joins the following lines into it, and a trailing '\' on
+	// the last line of the input, which otherwise drops the line.
+	Strict bool
+
+	// PreserveKeySpace causes keys to be everything before the separator,
+	// including any space around it, instead of being space trimmed and
+	// unquoted as they are by default. Keys written by Write will have a
+	// trailing space unless WriteOptions.Compact is set.
+	PreserveKeySpace bool
+
+	// RejectEmptyKey causes an error for entries without a key, like
+	// "= value", instead of emitting them with an empty key. Empty keys
+	// are allowed by default.
+	RejectEmptyKey bool
+
+	// RequireSpacedSeparator causes an error for entries where the separator
+	// is not surrounded by space, like "key=value" or "key =value". A
+	// separator at the start or end of the line, as written for an empty key
+	// or value, counts as surrounded on that side.
+	RequireSpacedSeparator bool
+
+	// DuplicateKeys controls what happens when a key is repeated within a
+	// section. If zero, every entry is emitted.
+	DuplicateKeys DuplicateKeyPolicy
+
+	// ExpandEnv causes ${VAR} and $VAR in values to be replaced with the
+	// value of the environment variable, or the empty string if it is
+	// unset. A literal '$' is written as $$.
+	ExpandEnv bool
+
+	// AllowIncludes causes a line of the form "@include path" to read the
+	// entries of the file at path in its place, starting in the current
+	// section. Sections declared by the included file remain in effect after
+	// it ends. Relative paths are relative to the directory of the including
+	// file, which is only known for inputs with a Name method like *os.File,
+	// and the current directory otherwise. Including a file that is already
+	// being read returns an error.
+	AllowIncludes bool
+
+	// Include, if set, enables includes like AllowIncludes but is called to
+	// open the path exactly as it is written after the directive, instead of
+	// opening a file. If the returned reader is an io.Closer, it is closed
+	// once it has been read or reading stops early. Including a path that is
+	// already being read returns an error.
+	Include func(path string) (io.Reader, error)
+
+	// IncludeDirective is the word that begins an include line. If empty,
+	// "@include" is used. It may begin with a comment prefix, as in
+	// "#include", to keep files readable by parsers without includes.
+	IncludeDirective string
+}
+
+// DuplicateKeyPolicy is what ReadWith does when a key is repeated within a
+// section.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateAllow emits every entry, so later values override earlier
+	// ones for callers that keep the last value.
+	DuplicateAllow DuplicateKeyPolicy = iota
+
+	// DuplicateError returns an error naming the section, key, and line of
+	// the repeated entry.
+	DuplicateError
+
+	// DuplicateFirstWins emits only the first entry for a key and silently
+	// skips any repeats.
+	DuplicateFirstWins
+)
+
+// commentPrefixes returns the configured comment prefixes or the default.
+func (o ReadOptions) commentPrefixes() []byte {
+	if len(o.CommentPrefixes) == 0 {
+		return []byte{'#'}
+	}
+	return o.CommentPrefixes
+}
+
+// separator returns the configured separator or the default.
+func (o ReadOptions) separator() byte {
+	if o.Separator == 0 {
+		return '='
+	}
+	return o.Separator
+}
+
+// includeDirective returns the configured include directive or the default.
+func (o ReadOptions) includeDirective() []byte {
+	if o.IncludeDirective == "" {
+		return []byte("@include")
+	}
+	return []byte(o.IncludeDirective)
+}
+
+// maxLineSize returns the configured maximum line size or the default.
+func (o ReadOptions) maxLineSize() int {
+	if o.MaxLineSize <= 0 {
+		return DefaultMaxLineSize
+	}
+	return o.MaxLineSize
+}
+
+// WriteOptions controls the behavior of WriteWith. The zero value matches
+// Write.
+type WriteOptions struct {
+	// Separator is the byte that separates a key from its value. If zero,
+	// '=' is used.
+	Separator byte
+
+	// Compact causes entries to be written without spaces around the
+	// separator, as in "key=value".
+	Compact bool
+
+	// AlignKeys pads the keys within a section so that their separators
+	// line up. The entries of each section are buffered until it ends.
+	AlignKeys bool
+
+	// OmitSectionSpacing removes the empty line written before every
+	// section declaration after the first entry.
+	OmitSectionSpacing bool
+
+	// DefaultSection is the section whose entries are written without a
+	// section declaration, or after "[]" if another section came first. It
+	// matches ReadOptions.DefaultSection so that entries read with it are
+	// written back without a declaration.
+	DefaultSection string
+
+	// Strict causes every entry to be checked with Entry.Validate before it
+	// is written. The first invalid entry stops any further writes and its
+	// error is returned.
+	Strict bool
+
+	// LineEnding ends every written line, including the lines of keys and
+	// sections that span multiple lines. If empty, "\n" is used. Set it to
+	// "\r\n" to write files for Windows. Any other line ending causes an
+	// error without writing anything.
+	LineEnding string
+}
+
+// separator returns the configured separator or the default.
+func (o WriteOptions) separator() byte {
+	if o.Separator == 0 {
+		return '='
+	}
+	return o.Separator
+}
+
+// lineEnding returns the configured line ending or the default.
+func (o WriteOptions) lineEnding() string {
+	if o.LineEnding == "" {
+		return "\n"
+	}
+	return o.LineEnding
+}
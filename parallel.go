@@ -0,0 +1,206 @@
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"unicode"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// ReadParallel is an experimental version of Read for large inputs that
+// parses the size bytes of ra with up to workers goroutines. It splits the
+// input into chunks at line boundaries, parses each chunk concurrently, and
+// calls cb with the entries of each chunk once every chunk before it is
+// done. The entries are the same as Read would return, cb is called in the
+// order they appear, and it is never called concurrently. Line numbers in a
+// ParseError count from the start of ra.
+//
+// A chunk only begins after an entry or section line that is neither a
+// continuation nor continued, so comments and logical lines never span
+// chunks. The only state that does is the current section: the entries of a
+// chunk before its first section declaration are given the last section
+// declared by the chunks before it.
+func ReadParallel(ra io.ReaderAt, size int64, workers int, cb func(ent Entry) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	bounds, err := splitChunks(ra, size, workers)
+	if err != nil {
+		return errs.Tag("read").Wrap(err)
+	}
+	return readChunks(ra, bounds, cb)
+}
+
+// readChunks parses the chunks of ra between consecutive bounds concurrently
+// and calls cb with their entries in order.
+func readChunks(ra io.ReaderAt, bounds []int64, cb func(ent Entry) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([]chan chunk, len(bounds)-1)
+	for i := range results {
+		results[i] = make(chan chunk, 1)
+		go func(i int) {
+			results[i] <- parseChunk(ctx, ra, bounds[i], bounds[i+1])
+		}(i)
+	}
+
+	section, lines := "", 0
+	for _, result := range results {
+		c := <-result
+		for i, ent := range c.ents {
+			if i < c.lead {
+				ent.Section = section
+			}
+			if err := cb(ent); errors.Is(err, ErrStop) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if c.err != nil {
+			var perr *ParseError
+			if errors.As(c.err, &perr) {
+				perr.Line += lines
+			}
+			return c.err
+		}
+		if c.declared {
+			section = c.section
+		}
+		lines += c.lines
+	}
+	return nil
+}
+
+// chunk is the result of parsing part of the input for ReadParallel.
+type chunk struct {
+	ents     []Entry
+	lead     int    // number of entries before the first section declaration
+	declared bool   // true if the chunk declares a section
+	section  string // the section in effect at the end of the chunk
+	lines    int    // number of newlines in the chunk
+	err      error
+}
+
+// parseChunk parses the bytes of ra from start to end as if they began in
+// the default section.
+func parseChunk(ctx context.Context, ra io.ReaderAt, start, end int64) (c chunk) {
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(io.NewSectionReader(ra, start, end-start), data); err != nil {
+		c.err = errs.Tag("read").Wrap(err)
+		return c
+	}
+	c.lines = bytes.Count(data, []byte{'\n'})
+
+	dec := newLinesDecoder(&byteLines{data: data}, ReadOptions{})
+	dec.ctx = ctx
+	dec.raw = func(line RawLine) error {
+		if line.Kind == SectionLine && !c.declared {
+			c.lead, c.declared = len(c.ents), true
+		}
+		return nil
+	}
+	c.err = readDecoder(dec, func(ent Entry) error {
+		c.ents = append(c.ents, ent)
+		return nil
+	})
+	if !c.declared {
+		c.lead = len(c.ents)
+	}
+	c.section = dec.ent.Section
+	return c
+}
+
+// splitChunks returns the offsets that split the size bytes of ra into at
+// most n chunks of roughly equal size, beginning with 0 and ending with size.
+func splitChunks(ra io.ReaderAt, size int64, n int) ([]int64, error) {
+	bounds := []int64{0}
+	for i := 1; i < n; i++ {
+		off := size * int64(i) / int64(n)
+		if last := bounds[len(bounds)-1]; off < last {
+			off = last
+		}
+		off, err := nextBoundary(ra, off, size)
+		if err != nil {
+			return nil, err
+		}
+		if off >= size {
+			break
+		}
+		bounds = append(bounds, off)
+	}
+	return append(bounds, size), nil
+}
+
+// nextBoundary returns the offset of the first line after off that a chunk
+// can begin with, or size if there is none. The line before it must be a
+// complete entry or section line so that no comment or continued line is
+// split, and it must not begin with a byte order mark, which would be
+// removed from the start of a chunk.
+func nextBoundary(ra io.ReaderAt, off, size int64) (int64, error) {
+	br := bufio.NewReader(io.NewSectionReader(ra, off, size-off))
+
+	// the line containing off may be partial, but its end is still the end
+	// of a line, so whether it is continued is known once the bytes before
+	// off are included, in case off is between a '\' and its line ending.
+	line, err := br.ReadBytes('\n')
+	if err == io.EOF {
+		return size, nil
+	} else if err != nil {
+		return 0, err
+	}
+	before, err := bytesBefore(ra, off, 2)
+	if err != nil {
+		return 0, err
+	}
+	off += int64(len(line))
+	prevContinued := continued(append(before, line...))
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+		off += int64(len(line))
+
+		if !prevContinued && !continued(line) && splittable(line) {
+			if next, _ := br.Peek(len(bom)); !bytes.Equal(next, bom) {
+				return off, nil
+			}
+		}
+		prevContinued = continued(line)
+	}
+}
+
+// bytesBefore returns up to n of the bytes of ra just before off.
+func bytesBefore(ra io.ReaderAt, off, n int64) ([]byte, error) {
+	if off < n {
+		n = off
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(io.NewSectionReader(ra, off-n, n), buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// continued returns true if the line, including its line ending, continues
+// onto the next line.
+func continued(line []byte) bool {
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+	return bytes.HasSuffix(line, []byte{'\\'})
+}
+
+// splittable returns true if the line is neither blank nor a comment, so
+// that the comment state is empty after it.
+func splittable(line []byte) bool {
+	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+	return len(line) > 0 && line[0] != '#'
+}
@@ -0,0 +1,120 @@
+package ini
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/errs/v2"
+)
+
+func TestReadParallel(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("\ufefftop = level\r\n")
+	for i := 0; i < 50; i++ {
+		if i%7 == 0 {
+			fmt.Fprintf(&b, "# section\n[s%d]\n", i)
+		}
+		fmt.Fprintf(&b, "# comment %d\n#\n\n# more\n", i)
+		fmt.Fprintf(&b, "k%d = v%d\n", i, i)
+		fmt.Fprintf(&b, "multi%d = a\\\n  b\\\n  c\n", i)
+		if i%11 == 0 {
+			b.WriteString("[]\n")
+		}
+	}
+	b.WriteString("last = entry")
+	data := b.String()
+
+	want, err := ReadAll(strings.NewReader(data))
+	assert.NoError(t, err)
+
+	for workers := -1; workers < 64; workers++ {
+		var got []Entry
+		err := ReadParallel(strings.NewReader(data), int64(len(data)), workers, func(ent Entry) error {
+			got = append(got, ent)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, want)
+	}
+}
+
+func TestReadParallel_EveryOffset(t *testing.T) {
+	inputs := []string{
+		"# c\\\n[s]\nb=2\r\nv = C:\\\\\n",
+		"a = 1\\\r\nb = 2\r\n[s]\\\nc = 3\n# d\\\r\ne = 4\r\n\ufefff = 5\n",
+	}
+
+	// build more inputs from fragments that continue or end lines in
+	// different ways.
+	frags := []string{"a = 1", "# c", "[s]", "", "b = \\", "\\", "\r", "\n", "\r\n", "\\\n", "\\\r\n"}
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 200; i++ {
+		var b strings.Builder
+		for j := 0; j < 12; j++ {
+			b.WriteString(frags[rng.Intn(len(frags))])
+		}
+		inputs = append(inputs, b.String())
+	}
+
+	for _, data := range inputs {
+		want, wantErr := ReadAll(strings.NewReader(data))
+		ra, size := strings.NewReader(data), int64(len(data))
+
+		for off := int64(0); off <= size; off++ {
+			next, err := nextBoundary(ra, off, size)
+			assert.NoError(t, err)
+			bounds := []int64{0, size}
+			if next > 0 && next < size {
+				bounds = []int64{0, next, size}
+			}
+
+			var got []Entry
+			err = readChunks(ra, bounds, func(ent Entry) error {
+				got = append(got, ent)
+				return nil
+			})
+			if wantErr != nil {
+				assert.Error(t, err)
+				assert.Equal(t, err.Error(), wantErr.Error())
+				continue
+			}
+			assert.NoError(t, err)
+			assert.DeepEqual(t, got, want)
+		}
+	}
+}
+
+func TestReadParallel_Errors(t *testing.T) {
+	data := strings.Repeat("a = 1\n", 100) + "invalid\n" + strings.Repeat("b = 2\n", 100)
+
+	for _, workers := range []int{1, 2, 4, 16} {
+		var got int
+		err := ReadParallel(strings.NewReader(data), int64(len(data)), workers, func(ent Entry) error {
+			got++
+			return nil
+		})
+		assert.That(t, errors.Is(err, errs.Tag("invalid line")))
+		assert.Equal(t, err.Error(), `invalid line: line 101: "invalid"`)
+		assert.Equal(t, got, 100)
+	}
+
+	data = strings.Repeat("a = 1\n", 200)
+	stop := errors.New("stop")
+	var got int
+	err := ReadParallel(strings.NewReader(data), int64(len(data)), 4, func(ent Entry) error {
+		got++
+		if got == 150 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, err, stop)
+	assert.Equal(t, got, 150)
+
+	err = ReadParallel(strings.NewReader(data), int64(len(data))+10, 4, func(ent Entry) error { return nil })
+	assert.That(t, errors.Is(err, errs.Tag("read")))
+}
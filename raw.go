@@ -0,0 +1,108 @@
+package ini
+
+import (
+	"fmt"
+	"io"
+)
+
+// LineKind is the kind of a RawLine.
+type LineKind int
+
+const (
+	// BlankLine is a line that is empty or only contains space.
+	BlankLine LineKind = iota + 1
+
+	// CommentLine is a comment.
+	CommentLine
+
+	// SectionLine is a section declaration.
+	SectionLine
+
+	// EntryLine is an entry.
+	EntryLine
+
+	// DroppedLine is a line continued at the end of the input, which has
+	// nothing to join and is dropped by Read.
+	DroppedLine
+)
+
+// String returns the name of the kind.
+func (k LineKind) String() string {
+	switch k {
+	case BlankLine:
+		return "blank"
+	case CommentLine:
+		return "comment"
+	case SectionLine:
+		return "section"
+	case EntryLine:
+		return "entry"
+	case DroppedLine:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// RawLine is a logical line of input, which may span multiple lines joined
+// by continuations.
+type RawLine struct {
+	// Kind is the kind of the line.
+	Kind LineKind
+
+	// Section is the section declared by a SectionLine, or the section that
+	// contains any other kind of line.
+	Section string
+
+	// Key and Value are the key and value of an EntryLine.
+	Key   string
+	Value string
+
+	// Comment is the contents of a CommentLine, as it would be added to the
+	// comment of the following entry.
+	Comment string
+
+	// Raw is the line exactly as it was read, including any continuations
+	// and its line ending.
+	Raw string
+}
+
+// ReadRaw parses r according to the package specification, calling cb with
+// every logical line, including the blank and comment lines that Read
+// discards. Comments are reported as their own lines rather than as part of
+// the entry that follows them.
+func ReadRaw(r io.Reader, cb func(line RawLine) error) error {
+	dec := newDecoder(r, ReadOptions{})
+	dec.raw = cb
+	return readDecoder(dec, func(ent Entry) error { return nil })
+}
+
+// WriteRaw writes every line emitted by cb. Lines with Raw contents are
+// written exactly as they are, so writing the lines from ReadRaw reproduces
+// its input. Other lines are formatted from their fields like Write would,
+// except that no empty lines are added before sections and the comments of
+// entries are not written: spacing and comments are written with BlankLine
+// and CommentLine lines instead. DroppedLine lines without Raw contents are
+// not written.
+func WriteRaw(w io.Writer, cb func(emit func(line RawLine))) error {
+	ew := &errWriter{w: w}
+	cb(func(line RawLine) {
+		if line.Raw != "" {
+			_, _ = io.WriteString(ew, line.Raw)
+			return
+		}
+
+		switch line.Kind {
+		case BlankLine:
+			fmt.Fprint(ew, "\n")
+		case CommentLine:
+			writeComment(ew, line.Comment, "\n")
+		case SectionLine:
+			fmt.Fprintf(ew, "[%s]\n", escape(escapeSection(line.Section, '='), "\n"))
+		case EntryLine:
+			writeEntry(ew, WriteOptions{}, Entry{Key: line.Key, Value: line.Value}, 0)
+		case DroppedLine:
+		}
+	})
+	return ew.err
+}
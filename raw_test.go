@@ -0,0 +1,100 @@
+package ini
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestReadRaw(t *testing.T) {
+	data := strings.Join([]string{
+		"top = 1",
+		"",
+		"# a comment",
+		"#no space",
+		"[section]",
+		"  \t",
+		"key = multi\\",
+		"line",
+		"",
+	}, "\r\n")
+
+	var got []RawLine
+	assert.NoError(t, ReadRaw(strings.NewReader(data), func(line RawLine) error {
+		got = append(got, line)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []RawLine{
+		{Kind: EntryLine, Key: "top", Value: "1", Raw: "top = 1\r\n"},
+		{Kind: BlankLine, Raw: "\r\n"},
+		{Kind: CommentLine, Comment: "a comment", Raw: "# a comment\r\n"},
+		{Kind: CommentLine, Comment: "no space", Raw: "#no space\r\n"},
+		{Kind: SectionLine, Section: "section", Raw: "[section]\r\n"},
+		{Kind: BlankLine, Section: "section", Raw: "  \t\r\n"},
+		{Kind: EntryLine, Section: "section", Key: "key", Value: "multi\nline", Raw: "key = multi\\\r\nline\r\n"},
+	})
+
+	var gotBytes []RawLine
+	dec := newLinesDecoder(&byteLines{data: []byte(data)}, ReadOptions{})
+	dec.raw = func(line RawLine) error {
+		gotBytes = append(gotBytes, line)
+		return nil
+	}
+	assert.NoError(t, readDecoder(dec, func(ent Entry) error { return nil }))
+	assert.DeepEqual(t, gotBytes, got)
+
+	assert.Error(t, ReadRaw(strings.NewReader("a = b\ninvalid"), func(line RawLine) error { return nil }))
+	assert.Equal(t, EntryLine.String(), "entry")
+
+	got = nil
+	assert.NoError(t, ReadRaw(strings.NewReader("[s]\nb = 2\\"), func(line RawLine) error {
+		got = append(got, line)
+		return nil
+	}))
+	assert.DeepEqual(t, got, []RawLine{
+		{Kind: SectionLine, Section: "s", Raw: "[s]\n"},
+		{Kind: DroppedLine, Section: "s", Raw: "b = 2\\"},
+	})
+	assert.Equal(t, DroppedLine.String(), "dropped")
+}
+
+func TestWriteRaw(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"\xEF\xBB\xBF# bom\r\na = 1",
+		"top = 1\n\n\n# comment\n  #  indented\n[ section ]\nkey   =   \"quoted\"  \r\nmulti = a\\\n  b\n\n",
+		"a = 1\nb = 2\\",
+		"a = 1\n# c\\",
+		"a = 1\n[s]\\\r\n",
+	} {
+		var lines []RawLine
+		assert.NoError(t, ReadRaw(strings.NewReader(data), func(line RawLine) error {
+			lines = append(lines, line)
+			return nil
+		}))
+
+		var buf bytes.Buffer
+		assert.NoError(t, WriteRaw(&buf, func(emit func(line RawLine)) {
+			for _, line := range lines {
+				emit(line)
+			}
+		}))
+		assert.Equal(t, buf.String(), data)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteRaw(&buf, func(emit func(line RawLine)) {
+		emit(RawLine{Kind: EntryLine, Key: "a", Value: "1"})
+		emit(RawLine{Kind: SectionLine, Section: "s"})
+		emit(RawLine{Kind: CommentLine, Comment: "note"})
+		emit(RawLine{Kind: EntryLine, Section: "s", Key: "b", Value: " 2 "})
+		emit(RawLine{Kind: BlankLine})
+	}))
+	assert.Equal(t, buf.String(), "a = 1\n[s]\n# note\nb = \" 2 \"\n\n")
+
+	assert.Equal(t, WriteRaw(failWriter{err: errLimit}, func(emit func(line RawLine)) {
+		emit(RawLine{Kind: BlankLine})
+	}), errLimit)
+}
@@ -0,0 +1,270 @@
+package ini
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// ErrKeyNotFound is returned by the typed accessors when the key does not
+// exist. Use errors.Is to check for it.
+var ErrKeyNotFound = errs.Tag("key not found")
+
+// Decode reads every entry from r into a map keyed by section and then by
+// key. Top-level entries are stored under the empty section "". When a key
+// is repeated within a section the last value wins. The order of entries,
+// their comments, and any duplicate values are not preserved.
+func Decode(r io.Reader) (map[string]map[string]string, error) {
+	m := make(map[string]map[string]string)
+	err := Read(r, func(ent Entry) error {
+		keys, ok := m[ent.Section]
+		if !ok {
+			keys = make(map[string]string)
+			m[ent.Section] = keys
+		}
+		keys[ent.Key] = ent.Value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DecodeMulti is like Decode but keeps every value of a key in the order
+// they appear, for keys that are repeated to form a list. Like Decode, it
+// reads with the DuplicateAllow policy, since rejecting or skipping repeated
+// keys would leave a single value for every key.
+func DecodeMulti(r io.Reader) (map[string]map[string][]string, error) {
+	m := make(map[string]map[string][]string)
+	err := Read(r, func(ent Entry) error {
+		keys, ok := m[ent.Section]
+		if !ok {
+			keys = make(map[string][]string)
+			m[ent.Section] = keys
+		}
+		keys[ent.Key] = append(keys[ent.Key], ent.Value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ToMap is the same as Decode. The order of sections and keys is lost by
+// design, so use Parse when it matters.
+func ToMap(r io.Reader) (map[string]map[string]string, error) {
+	return Decode(r)
+}
+
+// Encode writes the sections and keys of m to w. Sections and keys are
+// sorted so that the output is stable, which places the empty section first
+// as top-level entries without a section header.
+func Encode(w io.Writer, m map[string]map[string]string) error {
+	sections := make([]string, 0, len(m))
+	for section := range m {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	return Write(w, func(emit func(ent Entry)) {
+		for _, section := range sections {
+			keys := make([]string, 0, len(m[section]))
+			for key := range m[section] {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				emit(Entry{Section: section, Key: key, Value: m[section][key]})
+			}
+		}
+	})
+}
+
+// FromMap is the same as Encode.
+func FromMap(w io.Writer, m map[string]map[string]string) error {
+	return Encode(w, m)
+}
+
+// Values is a map of section to key to value, as returned by Decode, with
+// typed accessors.
+type Values map[string]map[string]string
+
+// Get returns the value of the key in the section.
+func (v Values) Get(section, key string) (string, bool) {
+	value, ok := v[section][key]
+	return value, ok
+}
+
+// lookup returns the value of the key in the section or an ErrKeyNotFound
+// error if it does not exist.
+func (v Values) lookup(section, key string) (string, error) {
+	value, ok := v.Get(section, key)
+	if !ok {
+		return "", ErrKeyNotFound.Errorf("section %q key %q", section, key)
+	}
+	return value, nil
+}
+
+// Int returns the value of the key in the section parsed as a base 10 int.
+func (v Values) Int(section, key string) (int, error) {
+	value, err := v.lookup(section, key)
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errs.Errorf("section %q key %q: %w", section, key, err)
+	}
+	return x, nil
+}
+
+// Bool returns the value of the key in the section parsed as a bool. It
+// accepts true/false, yes/no, on/off, and 1/0 in any case.
+func (v Values) Bool(section, key string) (bool, error) {
+	value, err := v.lookup(section, key)
+	if err != nil {
+		return false, err
+	}
+	x, err := parseBool(value)
+	if err != nil {
+		return false, errs.Errorf("section %q key %q: %w", section, key, err)
+	}
+	return x, nil
+}
+
+// Float returns the value of the key in the section parsed as a float64.
+func (v Values) Float(section, key string) (float64, error) {
+	value, err := v.lookup(section, key)
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errs.Errorf("section %q key %q: %w", section, key, err)
+	}
+	return x, nil
+}
+
+// MultiValues is a map of section to key to every value of the key, as
+// returned by DecodeMulti.
+type MultiValues map[string]map[string][]string
+
+// Get returns the last value of the key in the section.
+func (v MultiValues) Get(section, key string) (string, bool) {
+	values := v[section][key]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// Slice returns every value of the key in the section in order.
+func (v MultiValues) Slice(section, key string) []string {
+	return v[section][key]
+}
+
+// DecodeFold is like Decode but matches sections and keys case-insensitively,
+// so that "[Server]" and "[server]" are the same section. The casing of a
+// section or key when it is first read is kept.
+func DecodeFold(r io.Reader) (*FoldedValues, error) {
+	f := &FoldedValues{
+		values:   make(Values),
+		sections: make(map[string]string),
+		keys:     make(map[string]map[string]string),
+	}
+	err := Read(r, func(ent Entry) error {
+		section, key := fold(ent.Section, ent.Key)
+		if _, ok := f.sections[section]; !ok {
+			f.sections[section] = ent.Section
+			f.values[section] = make(map[string]string)
+			f.keys[section] = make(map[string]string)
+		}
+		if _, ok := f.keys[section][key]; !ok {
+			f.keys[section][key] = ent.Key
+		}
+		f.values[section][key] = ent.Value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// FoldedValues is like Values but sections and keys are matched
+// case-insensitively. It is returned by DecodeFold.
+type FoldedValues struct {
+	values   Values
+	sections map[string]string
+	keys     map[string]map[string]string
+}
+
+// Get returns the value of the key in the section.
+func (f *FoldedValues) Get(section, key string) (string, bool) {
+	return f.values.Get(fold(section, key))
+}
+
+// Int returns the value of the key in the section parsed as a base 10 int.
+func (f *FoldedValues) Int(section, key string) (int, error) {
+	return f.values.Int(fold(section, key))
+}
+
+// Bool returns the value of the key in the section parsed as a bool.
+func (f *FoldedValues) Bool(section, key string) (bool, error) {
+	return f.values.Bool(fold(section, key))
+}
+
+// Float returns the value of the key in the section parsed as a float64.
+func (f *FoldedValues) Float(section, key string) (float64, error) {
+	return f.values.Float(fold(section, key))
+}
+
+// fold returns the section and key as they are stored in FoldedValues.
+func fold(section, key string) (string, string) {
+	return strings.ToLower(section), strings.ToLower(key)
+}
+
+// CanonicalSection returns the section as it was first written.
+func (f *FoldedValues) CanonicalSection(section string) (string, bool) {
+	canon, ok := f.sections[strings.ToLower(section)]
+	return canon, ok
+}
+
+// CanonicalKey returns the key in the section as it was first written.
+func (f *FoldedValues) CanonicalKey(section, key string) (string, bool) {
+	section, key = fold(section, key)
+	canon, ok := f.keys[section][key]
+	return canon, ok
+}
+
+// Map returns the sections and keys with their canonical casing, suitable
+// for passing to Encode.
+func (f *FoldedValues) Map() map[string]map[string]string {
+	m := make(map[string]map[string]string, len(f.values))
+	for section, keys := range f.values {
+		out := make(map[string]string, len(keys))
+		for key, value := range keys {
+			out[f.keys[section][key]] = value
+		}
+		m[f.sections[section]] = out
+	}
+	return m
+}
+
+// parseBool parses the common textual forms of a bool case-insensitively.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	default:
+		return false, errs.Errorf("invalid bool: %q", value)
+	}
+}
@@ -0,0 +1,204 @@
+package ini
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestDecode(t *testing.T) {
+	m, err := Decode(strings.NewReader(strings.Join([]string{
+		"top = level",
+		"[a]",
+		"foo = 1",
+		"foo = 2",
+		"[b]",
+		"bar = baz",
+		"[a]",
+		"baz = 3",
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, m, map[string]map[string]string{
+		"":  {"top": "level"},
+		"a": {"foo": "2", "baz": "3"},
+		"b": {"bar": "baz"},
+	})
+
+	_, err = Decode(strings.NewReader("invalid"))
+	assert.Error(t, err)
+}
+
+func TestDecodeMulti(t *testing.T) {
+	m, err := DecodeMulti(strings.NewReader(strings.Join([]string{
+		"[remote]",
+		"fetch = a",
+		"url = x",
+		"fetch = b",
+		"[other]",
+		"fetch = c",
+		"[remote]",
+		"fetch = d",
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.DeepEqual(t, m, map[string]map[string][]string{
+		"remote": {"fetch": {"a", "b", "d"}, "url": {"x"}},
+		"other":  {"fetch": {"c"}},
+	})
+
+	v := MultiValues(m)
+	assert.DeepEqual(t, v.Slice("remote", "fetch"), []string{"a", "b", "d"})
+	assert.Equal(t, len(v.Slice("remote", "missing")), 0)
+
+	value, ok := v.Get("remote", "fetch")
+	assert.That(t, ok)
+	assert.Equal(t, value, "d")
+	_, ok = v.Get("missing", "fetch")
+	assert.That(t, !ok)
+
+	_, err = DecodeMulti(strings.NewReader("invalid"))
+	assert.Error(t, err)
+}
+
+func TestToMap(t *testing.T) {
+	for _, test := range tests {
+		exp := make(map[string]map[string]string)
+		for _, ent := range test.Entries {
+			if exp[ent.Section] == nil {
+				exp[ent.Section] = make(map[string]string)
+			}
+			exp[ent.Section][ent.Key] = ent.Value
+		}
+
+		got, err := ToMap(test.Reader())
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, exp)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m := map[string]map[string]string{
+		"b": {"z": "1", "a": "2"},
+		"":  {"top": "level"},
+		"a": {"foo": "bar\nbaz"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, m))
+	assert.Equal(t, buf.String(), strings.Join([]string{
+		"top = level",
+		"",
+		"[a]",
+		"foo = \"bar\\nbaz\"",
+		"",
+		"[b]",
+		"a = 2",
+		"z = 1",
+		"",
+	}, "\n"))
+
+	got, err := Decode(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, m)
+}
+
+func TestValues(t *testing.T) {
+	m, err := Decode(strings.NewReader(strings.Join([]string{
+		"[s]",
+		"int = -12",
+		"float = 1.5",
+		"yes = YES",
+		"off = Off",
+		"one = 1",
+		"bad = nope",
+	}, "\n")))
+	assert.NoError(t, err)
+	v := Values(m)
+
+	i, err := v.Int("s", "int")
+	assert.NoError(t, err)
+	assert.Equal(t, i, -12)
+
+	f, err := v.Float("s", "float")
+	assert.NoError(t, err)
+	assert.Equal(t, f, 1.5)
+
+	for key, exp := range map[string]bool{"yes": true, "off": false, "one": true} {
+		b, err := v.Bool("s", key)
+		assert.NoError(t, err)
+		assert.Equal(t, b, exp)
+	}
+
+	_, err = v.Int("s", "bad")
+	assert.Error(t, err)
+	assert.That(t, !errors.Is(err, ErrKeyNotFound))
+	_, err = v.Bool("s", "bad")
+	assert.Error(t, err)
+	assert.That(t, !errors.Is(err, ErrKeyNotFound))
+	_, err = v.Float("s", "bad")
+	assert.Error(t, err)
+	assert.That(t, !errors.Is(err, ErrKeyNotFound))
+
+	_, err = v.Int("s", "missing")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+	_, err = v.Bool("missing", "yes")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+	_, err = v.Float("", "float")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestFromMap(t *testing.T) {
+	m := map[string]map[string]string{
+		"z":      {"b": "1", "a": " padded "},
+		"":       {"top": "level"},
+		"a=b":    {"k=ey": "multi\nline"},
+		"server": {"host": "localhost", "port": "8080"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, FromMap(&buf, m))
+	assert.That(t, strings.HasPrefix(buf.String(), "top = level\n"))
+
+	got, err := ToMap(&buf)
+	assert.NoError(t, err)
+	assert.DeepEqual(t, got, m)
+}
+
+func TestDecodeFold(t *testing.T) {
+	f, err := DecodeFold(strings.NewReader(strings.Join([]string{
+		"[Server]",
+		"Port = 80",
+		"[server]",
+		"PORT = 8080",
+		"host = example",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	value, ok := f.Get("SERVER", "port")
+	assert.That(t, ok)
+	assert.Equal(t, value, "8080")
+
+	port, err := f.Int("server", "Port")
+	assert.NoError(t, err)
+	assert.Equal(t, port, 8080)
+
+	_, err = f.Int("server", "missing")
+	assert.That(t, errors.Is(err, ErrKeyNotFound))
+
+	section, ok := f.CanonicalSection("SERVER")
+	assert.That(t, ok)
+	assert.Equal(t, section, "Server")
+
+	key, ok := f.CanonicalKey("server", "port")
+	assert.That(t, ok)
+	assert.Equal(t, key, "Port")
+
+	_, ok = f.CanonicalKey("server", "missing")
+	assert.That(t, !ok)
+
+	assert.DeepEqual(t, f.Map(), map[string]map[string]string{
+		"Server": {"Port": "8080", "host": "example"},
+	})
+}
@@ -0,0 +1,208 @@
+package ini
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// Writer writes entries to an output stream one at a time, writing a
+// section declaration whenever the section changes. It is safe to call its
+// methods from multiple goroutines, though the entries are written in the
+// order the calls happen.
+type Writer struct {
+	mu      sync.Mutex
+	opts    WriteOptions
+	ew      *errWriter
+	section string
+	wrote   bool
+	pending []pendingLine
+}
+
+// pendingLine is an entry or a comment that is not attached to one,
+// buffered until the end of its section when aligning keys.
+type pendingLine struct {
+	ent       Entry
+	comment   string
+	isComment bool
+}
+
+// NewWriter returns a Writer that writes entries to w.
+func NewWriter(w io.Writer) *Writer {
+	return newWriter(w, WriteOptions{})
+}
+
+// newWriter returns a Writer that writes entries to w according to opts.
+func newWriter(w io.Writer, opts WriteOptions) *Writer {
+	wr := &Writer{
+		opts: opts,
+		ew:   &errWriter{w: w},
+	}
+	switch opts.LineEnding {
+	case "", "\n", "\r\n":
+	default:
+		wr.ew.err = errs.Errorf("invalid line ending %q: must be %q or %q",
+			opts.LineEnding, "\n", "\r\n")
+	}
+	return wr
+}
+
+// Emit writes the entry. Once a write fails, every later call returns the
+// error without writing.
+func (w *Writer) Emit(ent Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.ew.err != nil {
+		return w.ew.err
+	}
+	if w.opts.Strict {
+		if err := ent.Validate(); err != nil {
+			w.ew.err = err
+			return err
+		}
+	}
+
+	section := ent.Section
+	if section == w.opts.DefaultSection {
+		section = ""
+	}
+	if section != w.section {
+		w.flush()
+		nl := w.opts.lineEnding()
+		if w.wrote && !w.opts.OmitSectionSpacing {
+			fmt.Fprint(w.ew, nl)
+		}
+		fmt.Fprintf(w.ew, "[%s]%s", escape(escapeSection(section, w.opts.separator()), nl), nl)
+		w.section = section
+	}
+	if w.opts.AlignKeys {
+		w.pending = append(w.pending, pendingLine{ent: ent})
+	} else {
+		writeEntry(w.ew, w.opts, ent, 0)
+	}
+	w.wrote = true
+	return w.ew.err
+}
+
+// WriteComment writes every line of text as a comment line that is not
+// attached to an entry, such as a banner at the top of the file. It is
+// written in the current section, after the entries before it. Note that a
+// comment directly followed by an entry is read back as the comment of that
+// entry. Once a write fails, every later call returns the error without
+// writing.
+func (w *Writer) WriteComment(text string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.ew.err != nil {
+		return w.ew.err
+	}
+	if w.opts.Strict {
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasSuffix(line, `\`) || strings.HasSuffix(line, "\r") {
+				w.ew.err = errs.Tag("invalid comment").Errorf("line ends with '\\' or '\\r': %q", line)
+				return w.ew.err
+			}
+		}
+	}
+
+	if w.opts.AlignKeys {
+		w.pending = append(w.pending, pendingLine{comment: text, isComment: true})
+	} else {
+		writeComment(w.ew, text, w.opts.lineEnding())
+	}
+	w.wrote = true
+	return w.ew.err
+}
+
+// blank writes an empty line after any buffered entries.
+func (w *Writer) blank() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.ew.err != nil {
+		return w.ew.err
+	}
+	w.flush()
+	fmt.Fprint(w.ew, w.opts.lineEnding())
+	return w.ew.err
+}
+
+// Close writes any buffered entries and returns the first error from
+// writing, if any. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.flush()
+	return w.ew.err
+}
+
+// flush writes the buffered entries and comments of the current section.
+// When aligning, they are buffered until the section ends so that the width
+// of the longest key is known. Keys that span multiple lines are neither
+// padded nor counted.
+func (w *Writer) flush() {
+	width := 0
+	for _, line := range w.pending {
+		if line.isComment || strings.Contains(line.ent.Key, "\n") {
+			continue
+		}
+		if n := len(escapeKey(line.ent.Key, w.opts.separator())); n > width {
+			width = n
+		}
+	}
+	for _, line := range w.pending {
+		switch {
+		case line.isComment:
+			writeComment(w.ew, line.comment, w.opts.lineEnding())
+		case strings.Contains(line.ent.Key, "\n"):
+			writeEntry(w.ew, w.opts, line.ent, 0)
+		default:
+			writeEntry(w.ew, w.opts, line.ent, width)
+		}
+	}
+	w.pending = w.pending[:0]
+}
+
+// writeEntry writes the comment and entry line for ent with the key padded
+// to width.
+func writeEntry(w io.Writer, opts WriteOptions, ent Entry, width int) {
+	nl := opts.lineEnding()
+	if len(ent.Comment) > 0 {
+		writeComment(w, ent.Comment, nl)
+	}
+
+	sep := opts.separator()
+	key, value := escape(escapeKey(ent.Key, sep), nl), escape(quote(ent.Value), nl)
+
+	if opts.Compact {
+		fmt.Fprintf(w, "%-*s%c%s%s", width, key, sep, value, nl)
+		return
+	}
+
+	if len(key) > 0 || width > 0 {
+		fmt.Fprintf(w, "%-*s ", width, key)
+	}
+	fmt.Fprintf(w, "%c", sep)
+	if len(value) > 0 {
+		fmt.Fprintf(w, " %s", value)
+	}
+	fmt.Fprint(w, nl)
+}
+
+// writeComment writes every line of the comment as a comment line ending in
+// nl.
+func writeComment(w io.Writer, comment, nl string) {
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprint(w, "#")
+		if len(line) > 0 {
+			fmt.Fprintf(w, " %s", line)
+		}
+		fmt.Fprint(w, nl)
+	}
+}
@@ -0,0 +1,88 @@
+package ini
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestWriter(t *testing.T) {
+	for _, test := range tests {
+		var exp, got bytes.Buffer
+		assert.NoError(t, Write(&exp, func(emit func(ent Entry)) {
+			for _, ent := range test.Entries {
+				emit(ent)
+			}
+		}))
+
+		wr := NewWriter(&got)
+		for _, ent := range test.Entries {
+			assert.NoError(t, wr.Emit(ent))
+		}
+		assert.NoError(t, wr.Close())
+
+		assert.Equal(t, got.String(), exp.String())
+	}
+}
+
+type failWriter struct{ err error }
+
+func (f failWriter) Write(p []byte) (int, error) { return 0, f.err }
+
+func TestWriter_Error(t *testing.T) {
+	fail := errors.New("fail")
+	wr := NewWriter(failWriter{err: fail})
+	assert.Equal(t, wr.Emit(Entry{Key: "a", Value: "b"}), fail)
+	assert.Equal(t, wr.Emit(Entry{Key: "c", Value: "d"}), fail)
+	assert.Equal(t, wr.Close(), fail)
+}
+
+func TestWriter_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = wr.Emit(Entry{Key: fmt.Sprintf("k%d_%d", i, j), Value: "v"})
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.NoError(t, wr.Close())
+
+	ents, err := ReadAll(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, len(ents), 100)
+}
+
+func TestWriter_WriteComment(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	assert.NoError(t, wr.WriteComment("banner\n\nline"))
+	assert.NoError(t, wr.Emit(Entry{Section: "s", Key: "a", Value: "1"}))
+	assert.NoError(t, wr.WriteComment("trailer"))
+	assert.NoError(t, wr.Close())
+	assert.Equal(t, buf.String(), "# banner\n#\n# line\n\n[s]\na = 1\n# trailer\n")
+
+	buf.Reset()
+	wr = newWriter(&buf, WriteOptions{AlignKeys: true, Strict: true})
+	assert.NoError(t, wr.Emit(Entry{Key: "a", Value: "1"}))
+	assert.NoError(t, wr.WriteComment("middle"))
+	assert.NoError(t, wr.Emit(Entry{Key: "long", Value: "2"}))
+	assert.NoError(t, wr.Emit(Entry{Section: "s", Key: "b", Value: "3"}))
+	assert.NoError(t, wr.WriteComment("last"))
+	assert.NoError(t, wr.Close())
+	assert.Equal(t, buf.String(), "a    = 1\n# middle\nlong = 2\n\n[s]\nb = 3\n# last\n")
+
+	err := wr.WriteComment("bad\\")
+	assert.Error(t, err)
+	assert.Equal(t, wr.Close(), err)
+}